@@ -0,0 +1,258 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"jambuster.njvanhaute.com/internal/data"
+	"jambuster.njvanhaute.com/internal/storage"
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+// attachmentMimeType works out the format of an attachment from its first bytes alone,
+// as the type declared by the client is not trusted for files served back inline.
+// Text in a charset other than UTF-8 keeps its charset so that it fails validation.
+func attachmentMimeType(head []byte) string {
+	detected := http.DetectContentType(head)
+
+	mediaType, params, _ := mime.ParseMediaType(detected)
+	if charset, ok := params["charset"]; ok && charset != "utf-8" {
+		return detected
+	}
+
+	return mediaType
+}
+
+func (app *application) createAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	tune, err := app.models.Tunes.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.extendTransferDeadlines(w)
+
+	v := validator.New()
+
+	fields, file, err := app.readUpload(w, r, app.config.uploads.maxAttachmentSize, "kind", "instrument")
+	if err != nil {
+		switch {
+		case errors.Is(err, errMissingFile):
+			v.AddError("file", "must be provided")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.uploadErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	attachment := &data.Attachment{
+		TuneID:   tune.ID,
+		Kind:     fields["kind"],
+		Filename: file.filename,
+		MimeType: attachmentMimeType(file.head),
+	}
+
+	if instrument := fields["instrument"]; instrument != "" {
+		attachment.Instrument = &instrument
+	}
+
+	if data.ValidateAttachment(v, attachment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Attachments.Insert(attachment, file.body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.As(err, &maxBytesError), errors.Is(err, io.ErrUnexpectedEOF):
+			app.uploadErrorResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/tunes/%d/attachments/%d", tune.ID, attachment.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"attachment": attachment}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listAttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Kind       string
+		Instrument string
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Kind = app.readString(qs, "kind", "")
+	if input.Kind != "" {
+		v.Check(validator.PermittedValue(input.Kind, data.AttachmentKinds...), "kind", "must be one of "+strings.Join(data.AttachmentKinds, ", "))
+	}
+
+	input.Instrument = app.readString(qs, "instrument", "")
+	if input.Instrument != "" {
+		v.Check(validator.PermittedValue(input.Instrument, data.Instruments...), "instrument", "must be one of "+strings.Join(data.Instruments, ", "))
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Tunes.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	attachments, err := app.models.Attachments.GetAllForTune(id, input.Kind, input.Instrument)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"attachments": attachments}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readAttachment looks up the attachment named by the route's :id and :attachment_id
+// parameters.
+func (app *application) readAttachment(r *http.Request) (*data.Attachment, error) {
+	tuneID, err := app.readIDParam(r)
+	if err != nil {
+		return nil, data.ErrRecordNotFound
+	}
+
+	id, err := app.readNamedIDParam(r, "attachment_id")
+	if err != nil {
+		return nil, data.ErrRecordNotFound
+	}
+
+	return app.models.Attachments.Get(tuneID, id)
+}
+
+func (app *application) showAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	attachment, err := app.readAttachment(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"attachment": attachment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) downloadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	attachment, err := app.readAttachment(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	file, err := app.models.Attachments.Open(attachment)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.logError(r, fmt.Errorf("attachment %d has no stored file: %w", attachment.ID, err))
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	defer file.Close()
+
+	// Text is only accepted when it sniffs as UTF-8, so the charset can be given
+	contentType := attachment.MimeType
+	if contentType == "text/plain" {
+		contentType = "text/plain; charset=utf-8"
+	}
+
+	app.serveFile(w, r, file, attachment.Filename, contentType, attachment.Checksum, attachment.CreatedAt)
+}
+
+func (app *application) deleteAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	tuneID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	id, err := app.readNamedIDParam(r, "attachment_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Attachments.Delete(tuneID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+			return
+		case errors.Is(err, data.ErrStorageCleanup):
+			// The attachment is gone, so only the leftover file needs attention
+			app.logError(r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "attachment successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"jambuster.njvanhaute.com/internal/data"
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+func (app *application) createChordsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	tune, err := app.models.Tunes.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Key   data.Key         `json:"key"`
+		Parts []data.ChordPart `json:"parts"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	chart := &data.ChordChart{
+		TuneID: tune.ID,
+		Key:    input.Key,
+		Parts:  input.Parts,
+	}
+
+	v := validator.New()
+
+	if data.ValidateChordChart(v, chart, tune); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.ChordCharts.Insert(chart)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateChordChart):
+			v.AddError("tune", "already has chords, update them instead")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/tunes/%d/chords", tune.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"chords": chart}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showChordsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	chart, err := app.models.ChordCharts.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	format := app.readString(qs, "format", "absolute")
+	v.Check(validator.PermittedValue(format, "absolute", "nashville"), "format", "must be either absolute or nashville")
+
+	key := chart.Key
+	if s := app.readString(qs, "key", ""); s != "" {
+		key, err = data.ParseKey(s)
+		v.Check(err == nil, "key", "must be a valid key")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if format == "nashville" {
+		nashville := struct {
+			TuneID  int64                `json:"tune_id"`
+			Key     data.Key             `json:"key"`
+			Format  string               `json:"format"`
+			Parts   []data.NashvillePart `json:"parts"`
+			Version int32                `json:"version"`
+		}{
+			TuneID:  chart.TuneID,
+			Key:     key,
+			Format:  format,
+			Parts:   chart.Nashville(key),
+			Version: chart.Version,
+		}
+
+		err = app.writeJSON(w, http.StatusOK, envelope{"chords": nashville}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if key != chart.Key {
+		chart = chart.Transpose(key)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"chords": chart}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateChordsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	tune, err := app.models.Tunes.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	chart, err := app.models.ChordCharts.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Key   *data.Key        `json:"key"`
+		Parts []data.ChordPart `json:"parts"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Key != nil {
+		chart.Key = *input.Key
+	}
+
+	if input.Parts != nil {
+		chart.Parts = input.Parts
+	}
+
+	v := validator.New()
+
+	if data.ValidateChordChart(v, chart, tune); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.ChordCharts.Update(chart)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"chords": chart}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteChordsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.ChordCharts.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "chords successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
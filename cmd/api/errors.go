@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 )
@@ -41,10 +42,29 @@ func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.
 	app.errorResponse(w, r, http.StatusMethodNotAllowed, message)
 }
 
+func (app *application) notAcceptableResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the requested resource is not available in the requested format"
+	app.errorResponse(w, r, http.StatusNotAcceptable, message)
+}
+
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
 }
 
+// uploadErrorResponse reports an upload that could not be read, either because it
+// was too large or because the client sent a malformed body.
+func (app *application) uploadErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesError *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &maxBytesError):
+		message := fmt.Sprintf("body must not be larger than %d bytes", maxBytesError.Limit)
+		app.errorResponse(w, r, http.StatusRequestEntityTooLarge, message)
+	default:
+		app.badRequestResponse(w, r, err)
+	}
+}
+
 func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
 	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
 }
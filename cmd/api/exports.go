@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"jambuster.njvanhaute.com/internal/abc"
+	"jambuster.njvanhaute.com/internal/data"
+	"jambuster.njvanhaute.com/internal/midi"
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+// The tempo used for tunes without one of their own, in beats per minute
+const defaultExportTempo = 100
+
+// midiSequence renders the notes as a MIDI sequence in the tune's time signature and
+// first key, at a tempo in beats per minute counted in the time signature's beat unit.
+func midiSequence(tune *data.Tune, notes []abc.Note, tempo int) *midi.Sequence {
+	ts := tune.TimeSignature
+
+	// Compound meters are counted in dotted beats of three units
+	beat := 1.0 / float64(ts.Unit)
+	if ts.Kind() == "compound" {
+		beat *= 3
+	}
+
+	seq := &midi.Sequence{
+		Name:                   tune.Title,
+		Beats:                  ts.Beats,
+		Unit:                   ts.Unit,
+		ClocksPerClick:         int(math.Round(beat * 4 * 24)),
+		MicrosecondsPerQuarter: int(math.Round(60_000_000 / float64(tempo) * 0.25 / beat)),
+	}
+
+	if len(tune.Keys) > 0 {
+		seq.Sharps = int(tune.Keys[0].Signature())
+		seq.Minor = tune.Keys[0].Mode == "minor"
+	}
+
+	const ticksPerWhole = 4 * midi.Division
+
+	position := 0.0
+
+	for _, note := range notes {
+		start := int(math.Round(position * ticksPerWhole))
+		position += note.Length
+		end := int(math.Round(position * ticksPerWhole))
+
+		for _, pitch := range note.Pitches {
+			seq.Notes = append(seq.Notes, midi.Note{Start: start, Length: end - start, Pitch: pitch, Velocity: 80})
+		}
+	}
+
+	return seq
+}
+
+// exportMIDIHandler renders the tune's melody, given as ABC in the request or else the
+// tune's own ABC, as a MIDI file to practice along with. The repeats are played out
+// according to the tune's structure.
+func (app *application) exportMIDIHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	tune, err := app.models.Tunes.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		ABC *string `json:"abc"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	tempo := defaultExportTempo
+	if tune.Tempo != nil {
+		tempo = (tune.Tempo.Min + tune.Tempo.Max) / 2
+	}
+
+	tempo = app.readInt(r.URL.Query(), "tempo", tempo, v)
+	v.Check(tempo >= 20 && tempo <= 400, "tempo", "must be between 20 and 400 BPM")
+
+	// The ABC given may be a whole tune with header fields such as L:, while the
+	// tune's own ABC is only the body
+	var abcTune *abc.Tune
+
+	switch {
+	case input.ABC != nil:
+		abcTunes, err := abc.Parse(*input.ABC)
+		if err != nil {
+			v.AddError("abc", "must contain a tune")
+			break
+		}
+		abcTune = abcTunes[0]
+	case tune.ABC != nil:
+		abcTune = &abc.Tune{Body: *tune.ABC}
+	default:
+		v.AddError("abc", "must be provided, as the tune has no ABC of its own")
+	}
+
+	if abcTune != nil {
+		if err := abc.ValidateBody(abcTune.Body); err != nil {
+			v.AddError("abc", err.Error())
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	sharps := 0
+	if len(tune.Keys) > 0 {
+		sharps = int(tune.Keys[0].Signature())
+	}
+
+	melody, err := abcTune.Melody(tune.TimeSignature.Beats, tune.TimeSignature.Unit, sharps)
+	if err != nil {
+		switch {
+		case errors.Is(err, abc.ErrInvalidUnitLength):
+			v.AddError("abc", "L: field must be a valid unit note length such as 1/8")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var parts []string
+	if tune.ParsedStructure != nil {
+		for _, part := range tune.ParsedStructure.Parts {
+			parts = append(parts, part.Name)
+		}
+	}
+
+	file := midiSequence(tune, melody.Expand(parts), tempo).Encode()
+
+	w.Header().Set("Content-Type", "audio/midi")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": tune.Title + ".mid"}))
+	w.Header().Set("Content-Length", strconv.Itoa(len(file)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(file)
+}
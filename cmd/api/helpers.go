@@ -1,14 +1,18 @@
 package main
 
 import (
+	"bufio"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"jambuster.njvanhaute.com/internal/validator"
@@ -16,17 +20,31 @@ import (
 
 type envelope map[string]any
 
+const transferTimeout = 10 * time.Minute
+
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readNamedIDParam(r, "id")
+}
+
+// readNamedIDParam reads a positive integer ID from the named URL parameter, for routes
+// that identify a nested resource (ex: the alias_id in /v1/tunes/:id/aliases/:alias_id).
+func (app *application) readNamedIDParam(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
 
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 
 	return id, nil
 }
 
+// readStringParam reads the named URL parameter for resources identified by a string
+// rather than an integer (ex: the style ID in /v1/styles/:id).
+func (app *application) readStringParam(r *http.Request, name string) string {
+	return httprouter.ParamsFromContext(r.Context()).ByName(name)
+}
+
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
 	js, err := json.MarshalIndent(data, "", "\t")
 	if err != nil {
@@ -47,6 +65,54 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 	return nil
 }
 
+func (app *application) writeText(w http.ResponseWriter, status int, contentType string, body string, headers http.Header) error {
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	w.Write([]byte(body))
+
+	return nil
+}
+
+func (app *application) negotiateContentType(r *http.Request, offers ...string) string {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return offers[0]
+	}
+
+	best, bestQuality := offers[0], 0.0
+
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(mediaRange, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(name) == "q" {
+				q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				if err == nil {
+					quality = q
+				}
+			}
+		}
+
+		for _, offer := range offers {
+			matches := mediaType == offer || mediaType == "*/*" ||
+				(strings.HasSuffix(mediaType, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(mediaType, "*")))
+
+			if matches && quality > bestQuality {
+				best, bestQuality = offer, quality
+			}
+		}
+	}
+
+	return best
+}
+
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
 	maxBytes := 1_048_576
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
@@ -100,6 +166,89 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 	return nil
 }
 
+var errMissingFile = errors.New("body must contain a file")
+
+// upload is the file part of a multipart body read by readUpload. Head holds up to the
+// first 512 bytes of the file for sniffing its type, and body still starts at the
+// beginning of the file.
+type upload struct {
+	filename    string
+	contentType string // Type declared by the client, which is not to be trusted
+	head        []byte
+	body        io.Reader
+}
+
+// readUpload reads a multipart/form-data body of at most maxBytes, returning the named
+// form fields and the part called "file", or errMissingFile if there is none. The
+// file is not buffered, so it is left unread for the caller to stream and any fields
+// have to come before it.
+func (app *application) readUpload(w http.ResponseWriter, r *http.Request, maxBytes int64, fields ...string) (map[string]string, *upload, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, nil, errors.New("body must be multipart/form-data")
+	}
+
+	values := make(map[string]string)
+
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, nil, errMissingFile
+			}
+			return nil, nil, err
+		}
+
+		name := part.FormName()
+
+		switch {
+		case name == "file":
+			body := bufio.NewReaderSize(part, 512)
+
+			head, err := body.Peek(512)
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, nil, err
+			}
+
+			return values, &upload{filename: part.FileName(), contentType: part.Header.Get("Content-Type"), head: head, body: body}, nil
+		case slices.Contains(fields, name):
+			value, err := io.ReadAll(io.LimitReader(part, 1024))
+			if err != nil {
+				return nil, nil, err
+			}
+
+			values[name] = string(value)
+		default:
+			return nil, nil, fmt.Errorf("body contains unknown field %q", name)
+		}
+	}
+}
+
+// serveFile streams a stored file. http.ServeContent takes care of Range and
+// conditional requests, so clients can seek or resume without fetching the whole file.
+func (app *application) serveFile(w http.ResponseWriter, r *http.Request, file io.ReadSeeker, filename, contentType, checksum string, modified time.Time) {
+	app.extendTransferDeadlines(w)
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": filename}))
+	w.Header().Set("ETag", strconv.Quote(checksum))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	http.ServeContent(w, r, filename, modified, file)
+}
+
+// extendTransferDeadlines lifts the server's read and write timeouts for a request
+// that uploads or downloads a file, which can take far longer than a JSON request.
+func (app *application) extendTransferDeadlines(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+
+	deadline := time.Now().Add(transferTimeout)
+	rc.SetReadDeadline(deadline)
+	rc.SetWriteDeadline(deadline)
+}
+
 func (app *application) readString(qs url.Values, key string, defaultValue string) string {
 	s := qs.Get(key)
 
@@ -152,6 +301,22 @@ func (app *application) readBool(qs url.Values, key string, defaultValue *bool,
 	return &b
 }
 
+func (app *application) readDate(qs url.Values, key string, v *validator.Validator) *time.Time {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		v.AddError(key, "must be a date in the format YYYY-MM-DD")
+		return nil
+	}
+
+	return &t
+}
+
 func (app *application) background(fn func()) {
 	app.wg.Add(1)
 
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"jambuster.njvanhaute.com/internal/abc"
+	"jambuster.njvanhaute.com/internal/data"
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+type importResult struct {
+	Index  int               `json:"index"`
+	Title  string            `json:"title"`
+	Tune   *data.Tune        `json:"tune,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+type importSummary struct {
+	DryRun   bool           `json:"dry_run"`
+	Total    int            `json:"total"`
+	Imported int            `json:"imported"`
+	Failed   int            `json:"failed"`
+	Results  []importResult `json:"results"`
+}
+
+func (app *application) importABCHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ABC    string   `json:"abc"`
+		Styles []string `json:"styles"`
+		DryRun bool     `json:"dry_run"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.ABC != "", "abc", "must be provided")
+
+	// The styles apply to every tune, so unknown ones fail the whole import
+	input.Styles, err = app.readStyles(v, "styles", input.Styles)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	abcTunes, err := abc.Parse(input.ABC)
+	if err != nil {
+		switch {
+		case errors.Is(err, abc.ErrNoTunes):
+			v.AddError("abc", "must contain at least one tune")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	summary := importSummary{
+		DryRun:  input.DryRun,
+		Total:   len(abcTunes),
+		Results: []importResult{},
+	}
+
+	for i, abcTune := range abcTunes {
+		v := validator.New()
+
+		tune := tuneFromABC(v, abcTune, input.Styles)
+		lyrics := lyricsFromABC(abcTune)
+		result := importResult{Index: i + 1, Title: tune.Title}
+
+		data.ValidateTune(v, tune)
+		if lyrics != nil {
+			data.ValidateLyrics(v, lyrics)
+		}
+
+		if !v.Valid() {
+			result.Errors = v.Errors
+			summary.Failed++
+			summary.Results = append(summary.Results, result)
+			continue
+		}
+
+		if !input.DryRun {
+			// The tunes before this one are already saved, so a failure is reported
+			// against this tune rather than failing the whole file
+			err = app.models.Tunes.InsertWithLyrics(tune, lyrics)
+			if err != nil {
+				app.logError(r, err)
+
+				result.Errors = map[string]string{"tune": "could not be saved, please try importing it again"}
+				summary.Failed++
+				summary.Results = append(summary.Results, result)
+				continue
+			}
+		}
+
+		tune.HasLyrics = lyrics != nil
+
+		result.Tune = tune
+		summary.Imported++
+		summary.Results = append(summary.Results, result)
+	}
+
+	status := http.StatusCreated
+	if input.DryRun {
+		status = http.StatusOK
+	}
+
+	err = app.writeJSON(w, status, envelope{"import": summary}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func tuneFromABC(v *validator.Validator, abcTune *abc.Tune, styles []string) *data.Tune {
+	tune := &data.Tune{
+		Title:     abcTune.Title(),
+		Styles:    slices.Clone(styles),
+		Structure: abcTune.Structure(),
+	}
+
+	if abcTune.Body != "" {
+		tune.ABC = &abcTune.Body
+	}
+
+	// The R: field is only kept when it names a known tune type
+	if tuneType := canonicalTuneType(abcTune.Rhythm); tuneType != nil && slices.Contains(data.TuneTypes, *tuneType) {
+		tune.TuneType = tuneType
+	}
+
+	if abcTune.Key != "" {
+		name, err := abc.KeyName(abcTune.Key)
+		if err == nil {
+			var key data.Key
+			if key, err = data.ParseKey(name); err == nil {
+				tune.Keys = []data.Key{key}
+			}
+		}
+		v.Check(err == nil, "keys", "K: field must be a valid ABC key")
+	}
+
+	if abcTune.Meter != "" {
+		meter, err := abc.TimeSignature(abcTune.Meter)
+		if err == nil {
+			tune.TimeSignature, err = data.ParseTimeSignature(meter)
+		}
+		v.Check(err == nil, "time_signature", "M: field must be a valid ABC meter")
+	}
+
+	return tune
+}
+
+// lyricsFromABC builds lyrics from the tune's W: fields, starting a new verse at each
+// empty W: line. It returns nil when the tune has no words.
+func lyricsFromABC(abcTune *abc.Tune) *data.Lyrics {
+	var sections []data.LyricSection
+	var lines []string
+
+	for _, line := range slices.Concat(abcTune.Words, []string{""}) {
+		if line != "" {
+			lines = append(lines, line)
+			continue
+		}
+
+		if len(lines) > 0 {
+			sections = append(sections, data.LyricSection{Kind: "verse", Lines: lines})
+			lines = nil
+		}
+	}
+
+	if sections == nil {
+		return nil
+	}
+
+	return &data.Lyrics{Sections: sections}
+}
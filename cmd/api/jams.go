@@ -0,0 +1,465 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"jambuster.njvanhaute.com/internal/data"
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+// readJamUsers sets the jam's host and attendees from the given user IDs, adding a
+// validation error for any that do not exist. A nil hostID or attendeeIDs leaves the
+// corresponding field unchanged.
+func (app *application) readJamUsers(v *validator.Validator, jam *data.Jam, hostID *int64, attendeeIDs []int64) error {
+	if hostID != nil {
+		users, err := app.models.Jams.GetUsers([]int64{*hostID})
+		if err != nil {
+			return err
+		}
+
+		if v.Check(len(users) == 1, "host_id", "must be the ID of an existing user"); len(users) == 1 {
+			jam.Host = &users[0]
+		}
+	}
+
+	if attendeeIDs != nil {
+		users, err := app.models.Jams.GetUsers(attendeeIDs)
+		if err != nil {
+			return err
+		}
+
+		v.Check(validator.Unique(attendeeIDs), "attendee_ids", "must not contain duplicate values")
+		v.Check(len(users) == len(attendeeIDs), "attendee_ids", "must only contain IDs of existing users")
+		jam.Attendees = users
+	}
+
+	return nil
+}
+
+func (app *application) createJamHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Date        string  `json:"date"`
+		Location    string  `json:"location"`
+		HostID      *int64  `json:"host_id"`
+		AttendeeIDs []int64 `json:"attendee_ids"`
+		Notes       string  `json:"notes"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	jam := &data.Jam{
+		Date:      input.Date,
+		Location:  input.Location,
+		Attendees: []data.JamUser{},
+		Notes:     input.Notes,
+	}
+
+	// The user logging the jam hosts it unless someone else is named
+	if input.HostID == nil {
+		input.HostID = &app.contextGetUser(r).ID
+	}
+
+	v := validator.New()
+
+	err = app.readJamUsers(v, jam, input.HostID, input.AttendeeIDs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if data.ValidateJam(v, jam); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Jams.Insert(jam)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/jams/%d", jam.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"jam": jam}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showJamHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	jam, err := app.models.Jams.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"jam": jam}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateJamHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	jam, err := app.models.Jams.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Date        *string `json:"date"`
+		Location    *string `json:"location"`
+		HostID      *int64  `json:"host_id"`
+		AttendeeIDs []int64 `json:"attendee_ids"`
+		Notes       *string `json:"notes"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Date != nil {
+		jam.Date = *input.Date
+	}
+
+	if input.Location != nil {
+		jam.Location = *input.Location
+	}
+
+	if input.Notes != nil {
+		jam.Notes = *input.Notes
+	}
+
+	v := validator.New()
+
+	err = app.readJamUsers(v, jam, input.HostID, input.AttendeeIDs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if data.ValidateJam(v, jam); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Jams.Update(jam)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"jam": jam}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteJamHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Jams.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "jam successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listJamsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		From     *time.Time
+		To       *time.Time
+		Location string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.From = app.readDate(qs, "from", v)
+	input.To = app.readDate(qs, "to", v)
+	input.Location = app.readString(qs, "location", "")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-date")
+	input.Filters.SortSafelist = []string{"id", "date", "location", "-id", "-date", "-location"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	jams, metadata, err := app.models.Jams.GetAll(input.From, input.To, input.Location, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"jams": jams, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listJamPlaysHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	jam, err := app.models.Jams.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	plays, err := app.models.JamPlays.GetAllForJam(jam.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"plays": plays}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createJamPlayHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	jam, err := app.models.Jams.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		TuneID   int64      `json:"tune_id"`
+		PlayedAt *time.Time `json:"played_at"`
+		Key      *data.Key  `json:"key"`
+		Notes    string     `json:"notes"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	play := &data.JamPlay{
+		JamID:  jam.ID,
+		TuneID: input.TuneID,
+		Key:    input.Key,
+		Notes:  input.Notes,
+	}
+
+	if input.PlayedAt != nil {
+		play.PlayedAt = *input.PlayedAt
+	}
+
+	v := validator.New()
+
+	if data.ValidateJamPlay(v, play); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	tune, err := app.models.Tunes.Get(play.TuneID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("tune_id", "must be the ID of an existing tune")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	play.Title = tune.Title
+
+	err = app.models.JamPlays.Insert(play)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"play": play}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteJamPlayHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	playID, err := app.readNamedIDParam(r, "play_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.JamPlays.Delete(id, playID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "play successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) mostPlayedTunesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		From *time.Time
+		To   *time.Time
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.From = app.readDate(qs, "from", v)
+	input.To = app.readDate(qs, "to", v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-plays")
+	input.Filters.SortSafelist = []string{"plays", "title", "last_played", "-plays", "-title", "-last_played"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	stats, metadata, err := app.models.JamPlays.MostPlayed(input.From, input.To, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tunes": stats, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) unplayedTunesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Weeks int
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Weeks = app.readInt(qs, "weeks", 0, v)
+	v.Check(input.Weeks >= 1, "weeks", "must be at least 1")
+	v.Check(input.Weeks <= 520, "weeks", "must not be more than 520")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "last_played")
+	input.Filters.SortSafelist = []string{"plays", "title", "last_played", "-plays", "-title", "-last_played"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	stats, metadata, err := app.models.JamPlays.NotPlayedSince(input.Weeks, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tunes": stats, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+
+	"jambuster.njvanhaute.com/internal/data"
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+type keyChange struct {
+	From          data.Key          `json:"from"`
+	To            data.Key          `json:"to"`
+	FromSignature data.KeySignature `json:"from_signature"`
+	ToSignature   data.KeySignature `json:"to_signature"`
+}
+
+type transposition struct {
+	Semitones  int         `json:"semitones"`
+	KeyChanges []keyChange `json:"key_changes"`
+}
+
+func validateTransposeTarget(v *validator.Validator, key *data.Key, semitones *int) {
+	v.Check(key != nil || semitones != nil, "key", "must be provided if semitones is not")
+	v.Check(key == nil || semitones == nil, "semitones", "must not be provided together with key")
+
+	if semitones != nil {
+		v.Check(*semitones >= -11 && *semitones <= 11, "semitones", "must be between -11 and 11")
+	}
+}
+
+// transpose shifts every key by the same interval, keeping their modes. When a target
+// key is given the interval is measured from the first key to it, and every key is
+// spelled the same way, canonically.
+func transpose(keys []data.Key, target *data.Key, semitones *int) transposition {
+	t := transposition{KeyChanges: []keyChange{}}
+
+	if target != nil {
+		t.Semitones = data.Interval(keys[0], *target)
+	} else {
+		t.Semitones = *semitones
+	}
+
+	for _, key := range keys {
+		transposed := key.Transpose(t.Semitones)
+
+		t.KeyChanges = append(t.KeyChanges, keyChange{
+			From:          key,
+			To:            transposed,
+			FromSignature: key.Signature(),
+			ToSignature:   transposed.Signature(),
+		})
+	}
+
+	return t
+}
+
+func (app *application) transposeKeysHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Keys      []data.Key `json:"keys"`
+		Key       *data.Key  `json:"key"`
+		Semitones *int       `json:"semitones"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(len(input.Keys) >= 1, "keys", "must contain at least 1 key")
+	v.Check(len(input.Keys) <= 10, "keys", "must not contain more than 10 keys")
+	validateTransposeTarget(v, input.Key, input.Semitones)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"transposition": transpose(input.Keys, input.Key, input.Semitones)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
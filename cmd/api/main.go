@@ -16,6 +16,7 @@ import (
 	_ "github.com/lib/pq"
 	"jambuster.njvanhaute.com/internal/data"
 	"jambuster.njvanhaute.com/internal/mailer"
+	"jambuster.njvanhaute.com/internal/storage"
 	"jambuster.njvanhaute.com/internal/vcs"
 )
 
@@ -47,6 +48,11 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	uploads struct {
+		dir               string
+		maxRecordingSize  int64
+		maxAttachmentSize int64
+	}
 }
 
 type application struct {
@@ -84,6 +90,10 @@ func main() {
 		return nil
 	})
 
+	flag.StringVar(&cfg.uploads.dir, "uploads-dir", "./uploads", "Directory uploaded files are stored in")
+	flag.Int64Var(&cfg.uploads.maxAttachmentSize, "uploads-max-attachment-size", 10<<20, "Maximum size of an uploaded attachment in bytes")
+	flag.Int64Var(&cfg.uploads.maxRecordingSize, "uploads-max-recording-size", 50<<20, "Maximum size of an uploaded recording in bytes")
+
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 
 	flag.Parse()
@@ -105,6 +115,14 @@ func main() {
 
 	logger.Info("database connection pool established")
 
+	store, err := storage.NewLocal(cfg.uploads.dir)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	logger.Info("upload storage established", "dir", cfg.uploads.dir)
+
 	expvar.NewString("version").Set(version)
 
 	expvar.Publish("goroutines", expvar.Func(func() any {
@@ -122,7 +140,7 @@ func main() {
 	app := application{
 		config: cfg,
 		logger: logger,
-		models: data.NewModels(db),
+		models: data.NewModels(db, store),
 		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
 	}
 
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"jambuster.njvanhaute.com/internal/data"
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+func (app *application) listPracticeSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TuneID int64
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.TuneID = int64(app.readInt(qs, "tune", 0, v))
+	v.Check(input.TuneID >= 0, "tune", "must not be negative")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-practiced_at")
+	input.Filters.SortSafelist = []string{"practiced_at", "duration_seconds", "quality",
+		"-practiced_at", "-duration_seconds", "-quality"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	sessions, metadata, err := app.models.Practice.GetAllForUser(app.contextGetUser(r).ID, input.TuneID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"sessions": sessions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createPracticeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TuneID          int64  `json:"tune_id"`
+		DurationSeconds int    `json:"duration_seconds"`
+		Quality         *int   `json:"quality"`
+		Notes           string `json:"notes"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	session := &data.PracticeSession{
+		UserID:          app.contextGetUser(r).ID,
+		TuneID:          input.TuneID,
+		DurationSeconds: input.DurationSeconds,
+		Notes:           input.Notes,
+	}
+
+	v := validator.New()
+
+	if v.Check(input.Quality != nil, "quality", "must be provided"); input.Quality != nil {
+		session.Quality = *input.Quality
+	}
+
+	if data.ValidatePracticeSession(v, session); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	tune, err := app.models.Tunes.Get(session.TuneID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("tune_id", "must be the ID of an existing tune")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	session.Title = tune.Title
+
+	schedule, err := app.models.Practice.Insert(session)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"session": session, "schedule": schedule}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// practiceQueueHandler lists the tunes due for practice, most overdue first. The days
+// parameter looks that many days ahead so a user can plan past today.
+func (app *application) practiceQueueHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Days int
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Days = app.readInt(qs, "days", 0, v)
+	v.Check(input.Days >= 0, "days", "must not be negative")
+	v.Check(input.Days <= 365, "days", "must not be more than 365")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "due_at")
+	input.Filters.SortSafelist = []string{"due_at", "title", "ease_factor", "-due_at", "-title", "-ease_factor"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	until := time.Now().AddDate(0, 0, input.Days)
+
+	queue, metadata, err := app.models.Practice.Queue(app.contextGetUser(r).ID, until, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"queue": queue, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) practiceStatsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	weeks := app.readInt(r.URL.Query(), "weeks", 12, v)
+	v.Check(weeks >= 1, "weeks", "must be at least 1")
+	v.Check(weeks <= 104, "weeks", "must not be more than 104")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	stats, err := app.models.Practice.Stats(app.contextGetUser(r).ID, weeks)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"stats": stats}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
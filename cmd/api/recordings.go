@@ -0,0 +1,251 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"jambuster.njvanhaute.com/internal/data"
+	"jambuster.njvanhaute.com/internal/storage"
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+// recordingMimeType works out the audio format of an upload from its first bytes,
+// falling back to the type the client declared when the content is not recognised.
+// Aliases for the same format are folded onto the names in data.RecordingMimeTypes.
+func recordingMimeType(head []byte, declared string) string {
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if mediaType == "application/octet-stream" {
+		mediaType, _, _ = mime.ParseMediaType(declared)
+	}
+
+	switch mediaType {
+	case "audio/mp3", "audio/mpeg3":
+		return "audio/mpeg"
+	case "audio/wave", "audio/x-wav", "audio/vnd.wave":
+		return "audio/wav"
+	case "application/ogg", "audio/vorbis":
+		return "audio/ogg"
+	case "audio/x-flac":
+		return "audio/flac"
+	case "video/mp4", "audio/x-m4a", "audio/m4a":
+		return "audio/mp4"
+	case "audio/x-aiff":
+		return "audio/aiff"
+	}
+
+	return mediaType
+}
+
+func (app *application) createRecordingHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	tune, err := app.models.Tunes.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Recordings are streamed straight to storage rather than going through readJSON,
+	// so they have their own, much larger, size limit
+	app.extendTransferDeadlines(w)
+
+	v := validator.New()
+
+	fields, file, err := app.readUpload(w, r, app.config.uploads.maxRecordingSize, "duration_seconds")
+	if err != nil {
+		switch {
+		case errors.Is(err, errMissingFile):
+			v.AddError("file", "must be provided")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.uploadErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	recording := &data.Recording{
+		TuneID:   tune.ID,
+		Filename: file.filename,
+		MimeType: recordingMimeType(file.head, file.contentType),
+	}
+
+	if value, ok := fields["duration_seconds"]; ok {
+		duration, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			v.AddError("duration_seconds", "must be a number")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		recording.DurationSeconds = &duration
+	}
+
+	if data.ValidateRecording(v, recording); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Recordings.Insert(recording, file.body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.As(err, &maxBytesError), errors.Is(err, io.ErrUnexpectedEOF):
+			app.uploadErrorResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/tunes/%d/recordings/%d", tune.ID, recording.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"recording": recording}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listRecordingsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Tunes.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	recordings, err := app.models.Recordings.GetAllForTune(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"recordings": recordings}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readRecording looks up the recording named by the route's :id and :recording_id
+// parameters.
+func (app *application) readRecording(r *http.Request) (*data.Recording, error) {
+	tuneID, err := app.readIDParam(r)
+	if err != nil {
+		return nil, data.ErrRecordNotFound
+	}
+
+	id, err := app.readNamedIDParam(r, "recording_id")
+	if err != nil {
+		return nil, data.ErrRecordNotFound
+	}
+
+	return app.models.Recordings.Get(tuneID, id)
+}
+
+func (app *application) showRecordingHandler(w http.ResponseWriter, r *http.Request) {
+	recording, err := app.readRecording(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"recording": recording}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// downloadRecordingHandler streams the recording's audio, with support for Range
+// requests so that players can seek.
+func (app *application) downloadRecordingHandler(w http.ResponseWriter, r *http.Request) {
+	recording, err := app.readRecording(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	file, err := app.models.Recordings.Open(recording)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.logError(r, fmt.Errorf("recording %d has no stored file: %w", recording.ID, err))
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	defer file.Close()
+
+	app.serveFile(w, r, file, recording.Filename, recording.MimeType, recording.Checksum, recording.CreatedAt)
+}
+
+func (app *application) deleteRecordingHandler(w http.ResponseWriter, r *http.Request) {
+	tuneID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	id, err := app.readNamedIDParam(r, "recording_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Recordings.Delete(tuneID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+			return
+		case errors.Is(err, data.ErrStorageCleanup):
+			// The recording is gone, so only the leftover file needs attention
+			app.logError(r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "recording successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
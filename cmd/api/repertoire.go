@@ -0,0 +1,307 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"jambuster.njvanhaute.com/internal/data"
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+func (app *application) listRepertoireHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Proficiency string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Proficiency = app.readString(qs, "proficiency", "")
+	if input.Proficiency != "" {
+		v.Check(validator.PermittedValue(input.Proficiency, data.ProficiencyLevels...), "proficiency", "must be one of "+strings.Join(data.ProficiencyLevels, ", "))
+	}
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "title")
+	input.Filters.SortSafelist = []string{"title", "proficiency", "last_practiced_at", "-title", "-proficiency", "-last_practiced_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	entries, metadata, err := app.models.Repertoire.GetAllForUser(user.ID, input.Proficiency, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"repertoire": entries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createRepertoireEntryHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TuneID          int64      `json:"tune_id"`
+		Proficiency     string     `json:"proficiency"`
+		PreferredKey    *data.Key  `json:"preferred_key"`
+		Instrument      string     `json:"instrument"`
+		LastPracticedAt *time.Time `json:"last_practiced_at"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	entry := &data.RepertoireEntry{
+		UserID:          app.contextGetUser(r).ID,
+		TuneID:          input.TuneID,
+		Proficiency:     input.Proficiency,
+		PreferredKey:    input.PreferredKey,
+		Instrument:      input.Instrument,
+		LastPracticedAt: input.LastPracticedAt,
+	}
+
+	v := validator.New()
+
+	if data.ValidateRepertoireEntry(v, entry); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	tune, err := app.models.Tunes.Get(entry.TuneID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("tune_id", "must be the ID of an existing tune")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	entry.Title = tune.Title
+
+	err = app.models.Repertoire.Insert(entry)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateRepertoireEntry):
+			v.AddError("tune_id", "is already in your repertoire, update it instead")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/users/me/repertoire/%d", entry.TuneID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"entry": entry}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showRepertoireEntryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	entry, err := app.models.Repertoire.Get(app.contextGetUser(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"entry": entry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateRepertoireEntryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	entry, err := app.models.Repertoire.Get(app.contextGetUser(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Proficiency     *string    `json:"proficiency"`
+		PreferredKey    *data.Key  `json:"preferred_key"`
+		Instrument      *string    `json:"instrument"`
+		LastPracticedAt *time.Time `json:"last_practiced_at"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Proficiency != nil {
+		entry.Proficiency = *input.Proficiency
+	}
+
+	if input.PreferredKey != nil {
+		entry.PreferredKey = input.PreferredKey
+	}
+
+	if input.Instrument != nil {
+		entry.Instrument = *input.Instrument
+	}
+
+	if input.LastPracticedAt != nil {
+		entry.LastPracticedAt = input.LastPracticedAt
+	}
+
+	v := validator.New()
+
+	if data.ValidateRepertoireEntry(v, entry); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Repertoire.Update(entry)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"entry": entry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteRepertoireEntryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Repertoire.Delete(app.contextGetUser(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "tune successfully removed from repertoire"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listCommonTunesHandler answers "what can we all play?": it lists the tunes every one
+// of the given users has in their repertoire, ranked by the weakest player's comfort
+// with the tune, and narrowed down with the same filters as listTunesHandler.
+func (app *application) listCommonTunesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.TuneFilters
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	var err error
+
+	input.TuneFilters, err = app.readTuneFilters(r, qs, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for _, s := range app.readCSV(qs, "users", []string{}) {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || id < 1 {
+			v.AddError("users", "must be a comma-separated list of user IDs")
+			break
+		}
+		input.PlayerIDs = append(input.PlayerIDs, id)
+	}
+
+	v.Check(len(input.PlayerIDs) > 0, "users", "must contain at least 1 user ID")
+	v.Check(len(input.PlayerIDs) <= 50, "users", "must not contain more than 50 user IDs")
+	v.Check(validator.Unique(input.PlayerIDs), "users", "must not contain duplicate values")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-comfort")
+	input.Filters.SortSafelist = []string{"comfort", "id", "title", "time_signature", "tempo_min", "tempo_max", "structure", "relevance",
+		"-comfort", "-id", "-title", "-time_signature", "-tempo_min", "-tempo_max", "-structure"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	users, err := app.models.Jams.GetUsers(input.PlayerIDs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if v.Check(len(users) == len(input.PlayerIDs), "users", "must only contain IDs of existing users"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	tunes, metadata, err := app.models.Tunes.GetAll(input.TuneFilters, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"players": users, "tunes": tunes, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -21,12 +21,108 @@ func (app *application) routes() http.Handler {
 	router.HandlerFunc(http.MethodGet, "/v1/tunes/:id", app.requirePermission("tunes:read", app.showTuneHandler))
 	router.HandlerFunc(http.MethodPatch, "/v1/tunes/:id", app.requirePermission("tunes:write", app.updateTuneHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/tunes/:id", app.requirePermission("tunes:write", app.deleteTuneHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tunes/:id/similar", app.requirePermission("tunes:read", app.listSimilarTunesHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/tunes/:id/aliases", app.requirePermission("tunes:read", app.listAliasesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tunes/:id/aliases", app.requirePermission("tunes:write", app.createAliasHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tunes/:id/aliases/:alias_id", app.requirePermission("tunes:write", app.deleteAliasHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/tunes/:id/chords", app.requirePermission("tunes:read", app.showChordsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tunes/:id/chords", app.requirePermission("tunes:write", app.createChordsHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/tunes/:id/chords", app.requirePermission("tunes:write", app.updateChordsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tunes/:id/chords", app.requirePermission("tunes:write", app.deleteChordsHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/tunes/:id/lyrics", app.requirePermission("tunes:read", app.showLyricsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tunes/:id/lyrics", app.requirePermission("tunes:write", app.createLyricsHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/tunes/:id/lyrics", app.requirePermission("tunes:write", app.updateLyricsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tunes/:id/lyrics", app.requirePermission("tunes:write", app.deleteLyricsHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/tunes/:id/attachments", app.requirePermission("tunes:read", app.listAttachmentsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tunes/:id/attachments", app.requirePermission("tunes:write", app.createAttachmentHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tunes/:id/attachments/:attachment_id", app.requirePermission("tunes:read", app.showAttachmentHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tunes/:id/attachments/:attachment_id/file", app.requirePermission("tunes:read", app.downloadAttachmentHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tunes/:id/attachments/:attachment_id", app.requirePermission("tunes:write", app.deleteAttachmentHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/tunes/:id/recordings", app.requirePermission("tunes:read", app.listRecordingsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tunes/:id/recordings", app.requirePermission("tunes:write", app.createRecordingHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tunes/:id/recordings/:recording_id", app.requirePermission("tunes:read", app.showRecordingHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tunes/:id/recordings/:recording_id/audio", app.requirePermission("tunes:read", app.downloadRecordingHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tunes/:id/recordings/:recording_id", app.requirePermission("tunes:write", app.deleteRecordingHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/tunes/:id/transpose", app.requirePermission("tunes:read", app.transposeTuneHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tunes/:id/export.mid", app.requirePermission("tunes:read", app.exportMIDIHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/keys/transpose", app.requirePermission("tunes:read", app.transposeKeysHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/sets", app.requirePermission("tunes:read", app.listSetsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/sets", app.requirePermission("tunes:write", app.createSetHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/sets/:id", app.requirePermission("tunes:read", app.showSetHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/sets/:id", app.requirePermission("tunes:write", app.updateSetHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/sets/:id", app.requirePermission("tunes:write", app.deleteSetHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/setlists", app.requirePermission("tunes:read", app.listSetlistsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/setlists", app.requirePermission("tunes:write", app.createSetlistHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/setlists/:id", app.requirePermission("tunes:read", app.showSetlistHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/setlists/:id", app.requirePermission("tunes:write", app.updateSetlistHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/setlists/:id", app.requirePermission("tunes:write", app.deleteSetlistHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/setlists/:id/analysis", app.requirePermission("tunes:read", app.analyzeSetlistHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/setlists/:id/export", app.requirePermission("tunes:read", app.exportSetlistHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/jams", app.requirePermission("tunes:read", app.listJamsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/jams", app.requirePermission("tunes:write", app.createJamHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/jams/:id", app.requirePermission("tunes:read", app.showJamHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/jams/:id", app.requirePermission("tunes:write", app.updateJamHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/jams/:id", app.requirePermission("tunes:write", app.deleteJamHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/jams/:id/plays", app.requirePermission("tunes:read", app.listJamPlaysHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/jams/:id/plays", app.requirePermission("tunes:write", app.createJamPlayHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/jams/:id/plays/:play_id", app.requirePermission("tunes:write", app.deleteJamPlayHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/jam-stats/most-played", app.requirePermission("tunes:read", app.mostPlayedTunesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/jam-stats/unplayed", app.requirePermission("tunes:read", app.unplayedTunesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/jam-matcher", app.requirePermission("tunes:read", app.listCommonTunesHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/composers", app.requirePermission("tunes:read", app.listComposersHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/composers", app.requirePermission("tunes:write", app.createComposerHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/composers/:id", app.requirePermission("tunes:read", app.showComposerHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/composers/:id", app.requirePermission("tunes:write", app.updateComposerHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/composers/:id", app.requirePermission("tunes:write", app.deleteComposerHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/sources", app.requirePermission("tunes:read", app.listSourcesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/sources", app.requirePermission("tunes:write", app.createSourceHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/sources/:id", app.requirePermission("tunes:read", app.showSourceHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/sources/:id", app.requirePermission("tunes:write", app.updateSourceHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/sources/:id", app.requirePermission("tunes:write", app.deleteSourceHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/styles", app.requirePermission("tunes:read", app.listStylesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/styles", app.requirePermission("tunes:write", app.createStyleHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/styles/:id", app.requirePermission("tunes:read", app.showStyleHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/styles/:id", app.requirePermission("tunes:write", app.updateStyleHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/styles/:id", app.requirePermission("tunes:write", app.deleteStyleHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/unmatched-styles", app.requirePermission("tunes:read", app.listUnmatchedStylesHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/tunings", app.requirePermission("tunes:read", app.listTuningsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tunings", app.requirePermission("tunes:write", app.createTuningHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tunings/:id", app.requirePermission("tunes:read", app.showTuningHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/tunings/:id", app.requirePermission("tunes:write", app.updateTuningHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tunings/:id", app.requirePermission("tunes:write", app.deleteTuningHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/imports/abc", app.requirePermission("tunes:write", app.importABCHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 
 	router.HandlerFunc(http.MethodPut, "/v1/users/activate", app.activateUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
 
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/repertoire", app.requireActivatedUser(app.listRepertoireHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/repertoire", app.requireActivatedUser(app.createRepertoireEntryHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/repertoire/:id", app.requireActivatedUser(app.showRepertoireEntryHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me/repertoire/:id", app.requireActivatedUser(app.updateRepertoireEntryHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/repertoire/:id", app.requireActivatedUser(app.deleteRepertoireEntryHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/practice", app.requireActivatedUser(app.listPracticeSessionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/practice", app.requireActivatedUser(app.createPracticeSessionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/practice/queue", app.requireActivatedUser(app.practiceQueueHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/practice/stats", app.requireActivatedUser(app.practiceStatsHandler))
+
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
 
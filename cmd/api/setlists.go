@@ -0,0 +1,396 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"jambuster.njvanhaute.com/internal/data"
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+type setlistEntryInput struct {
+	TuneID          int64     `json:"tune_id"`
+	Key             *data.Key `json:"key"`
+	DurationSeconds int       `json:"duration_seconds"`
+	Notes           string    `json:"notes"`
+}
+
+// readSetlistEntries looks up each tune in the input and returns the setlist entries,
+// adding a validation error if any of them does not exist. Entries without a chosen
+// key are played in the tune's first key, whichever it is at the time.
+func (app *application) readSetlistEntries(v *validator.Validator, input []setlistEntryInput) ([]data.SetlistEntry, error) {
+	if input == nil {
+		return nil, nil
+	}
+
+	entries := []data.SetlistEntry{}
+
+	for _, in := range input {
+		tune, err := app.models.Tunes.Get(in.TuneID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("entries", fmt.Sprintf("must only contain existing tunes (tune %d does not exist)", in.TuneID))
+				continue
+			default:
+				return nil, err
+			}
+		}
+
+		entry := data.SetlistEntry{
+			TuneID:          tune.ID,
+			Title:           tune.Title,
+			DurationSeconds: in.DurationSeconds,
+			Notes:           in.Notes,
+		}
+
+		switch {
+		case in.Key != nil:
+			entry.Key = *in.Key
+			entry.KeyChosen = true
+		case len(tune.Keys) > 0:
+			entry.Key = tune.Keys[0]
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func (app *application) createSetlistHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name    string              `json:"name"`
+		Notes   string              `json:"notes"`
+		Entries []setlistEntryInput `json:"entries"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	entries, err := app.readSetlistEntries(v, input.Entries)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	setlist := &data.Setlist{
+		Name:    input.Name,
+		Notes:   input.Notes,
+		Entries: entries,
+	}
+
+	if data.ValidateSetlist(v, setlist); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Setlists.Insert(setlist)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/setlists/%d", setlist.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"setlist": setlist}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showSetlistHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	setlist, err := app.models.Setlists.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"setlist": setlist}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateSetlistHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	setlist, err := app.models.Setlists.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Name    *string             `json:"name"`
+		Notes   *string             `json:"notes"`
+		Entries []setlistEntryInput `json:"entries"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if input.Name != nil {
+		setlist.Name = *input.Name
+	}
+
+	if input.Notes != nil {
+		setlist.Notes = *input.Notes
+	}
+
+	if input.Entries != nil {
+		setlist.Entries, err = app.readSetlistEntries(v, input.Entries)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if data.ValidateSetlist(v, setlist); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Setlists.Update(setlist)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"setlist": setlist}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteSetlistHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Setlists.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "setlist successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listSetlistsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Name = app.readString(qs, "name", "")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafelist = []string{"id", "name", "-id", "-name"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	setlists, metadata, err := app.models.Setlists.GetAll(input.Name, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"setlists": setlists, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) analyzeSetlistHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	setlist, err := app.models.Setlists.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"setlist_id": setlist.ID, "issues": setlist.Analyze()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) exportSetlistHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	format := app.readString(r.URL.Query(), "format", "text")
+	if v.Check(validator.PermittedValue(format, "text", "markdown"), "format", "must be either text or markdown"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	setlist, err := app.models.Setlists.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+
+	if format == "markdown" {
+		headers.Set("Content-Disposition", fmt.Sprintf("inline; filename=\"setlist-%d.md\"", setlist.ID))
+
+		err = app.writeText(w, http.StatusOK, "text/markdown; charset=utf-8", setlistMarkdown(setlist), headers)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers.Set("Content-Disposition", fmt.Sprintf("inline; filename=\"setlist-%d.txt\"", setlist.ID))
+
+	err = app.writeText(w, http.StatusOK, "text/plain; charset=utf-8", setlistText(setlist), headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// formatDuration writes a number of seconds as minutes and seconds (ex: 3:05), or a
+// dash when there is no estimate.
+func formatDuration(seconds int) string {
+	if seconds == 0 {
+		return "-"
+	}
+
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+func setlistTotal(setlist *data.Setlist) string {
+	total := fmt.Sprintf("%d tunes, %s", len(setlist.Entries), formatDuration(setlist.TotalDurationSeconds))
+	if setlist.UntimedEntries > 0 {
+		total += fmt.Sprintf(" (%d without an estimate)", setlist.UntimedEntries)
+	}
+
+	return total
+}
+
+// setlistText writes the setlist as plain text, laid out to be read from the stage.
+func setlistText(setlist *data.Setlist) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s\n", setlist.Name)
+	if setlist.Notes != "" {
+		fmt.Fprintf(&b, "%s\n", setlist.Notes)
+	}
+	b.WriteString("\n")
+
+	for i, entry := range setlist.Entries {
+		fmt.Fprintf(&b, "%2d. %s (%s) %s\n", i+1, entry.Title, entry.Key, formatDuration(entry.DurationSeconds))
+		if entry.Notes != "" {
+			fmt.Fprintf(&b, "    %s\n", entry.Notes)
+		}
+	}
+
+	fmt.Fprintf(&b, "\nTotal: %s\n", setlistTotal(setlist))
+
+	return b.String()
+}
+
+// setlistMarkdown writes the setlist as a Markdown table.
+func setlistMarkdown(setlist *data.Setlist) string {
+	cell := strings.NewReplacer("|", `\|`, "\n", " ").Replace
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s\n\n", setlist.Name)
+	if setlist.Notes != "" {
+		fmt.Fprintf(&b, "%s\n\n", setlist.Notes)
+	}
+
+	b.WriteString("| # | Tune | Key | Time | Notes |\n")
+	b.WriteString("|--:|------|-----|-----:|-------|\n")
+
+	for i, entry := range setlist.Entries {
+		fmt.Fprintf(&b, "| %d | %s | %s | %s | %s |\n", i+1, cell(entry.Title), entry.Key,
+			formatDuration(entry.DurationSeconds), cell(entry.Notes))
+	}
+
+	fmt.Fprintf(&b, "\n**Total:** %s\n", setlistTotal(setlist))
+
+	return b.String()
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"jambuster.njvanhaute.com/internal/data"
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+type setTuneInput struct {
+	TuneID  int64     `json:"tune_id"`
+	Key     *data.Key `json:"key"`
+	Repeats int       `json:"repeats"`
+}
+
+// readSetTunes looks up each tune in the input and returns the tunes of the set, adding
+// a validation error if any of them does not exist. The repeat count defaults to 1.
+func (app *application) readSetTunes(v *validator.Validator, input []setTuneInput) ([]data.SetTune, error) {
+	if input == nil {
+		return nil, nil
+	}
+
+	tunes := []data.SetTune{}
+
+	for _, in := range input {
+		tune, err := app.models.Tunes.Get(in.TuneID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("tunes", fmt.Sprintf("must only contain existing tunes (tune %d does not exist)", in.TuneID))
+				continue
+			default:
+				return nil, err
+			}
+		}
+
+		setTune := data.SetTune{
+			TuneID:        tune.ID,
+			Title:         tune.Title,
+			TimeSignature: tune.TimeSignature,
+			Key:           in.Key,
+			Repeats:       in.Repeats,
+		}
+
+		if setTune.Repeats == 0 {
+			setTune.Repeats = 1
+		}
+
+		tunes = append(tunes, setTune)
+	}
+
+	return tunes, nil
+}
+
+func (app *application) createSetHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name  string         `json:"name"`
+		Tunes []setTuneInput `json:"tunes"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	tunes, err := app.readSetTunes(v, input.Tunes)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	set := &data.Set{
+		Name:  input.Name,
+		Tunes: tunes,
+	}
+
+	if data.ValidateSet(v, set); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Sets.Insert(set)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/sets/%d", set.ID))
+
+	env := envelope{"set": set}
+	if warnings := set.Warnings(); warnings != nil {
+		env["warnings"] = warnings
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showSetHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	set, err := app.models.Sets.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env := envelope{"set": set}
+	if warnings := set.Warnings(); warnings != nil {
+		env["warnings"] = warnings
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateSetHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	set, err := app.models.Sets.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Name  *string        `json:"name"`
+		Tunes []setTuneInput `json:"tunes"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if input.Name != nil {
+		set.Name = *input.Name
+	}
+
+	if input.Tunes != nil {
+		set.Tunes, err = app.readSetTunes(v, input.Tunes)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if data.ValidateSet(v, set); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Sets.Update(set)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env := envelope{"set": set}
+	if warnings := set.Warnings(); warnings != nil {
+		env["warnings"] = warnings
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteSetHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Sets.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "set successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listSetsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name   string
+		TuneID int64
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Name = app.readString(qs, "name", "")
+	input.TuneID = int64(app.readInt(qs, "tune", 0, v))
+	v.Check(input.TuneID >= 0, "tune", "must not be negative")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafelist = []string{"id", "name", "-id", "-name"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	sets, metadata, err := app.models.Sets.GetAll(input.Name, input.TuneID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"sets": sets, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"jambuster.njvanhaute.com/internal/data"
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+// readStyles resolves the given style names, IDs or synonyms to their canonical style
+// IDs, dropping repeats, and adds a validation error naming any that are not known.
+// A nil slice is returned as is so that required checks still apply.
+func (app *application) readStyles(v *validator.Validator, key string, names []string) ([]string, error) {
+	if len(names) == 0 {
+		return names, nil
+	}
+
+	resolved, err := app.models.Styles.Resolve(names)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	var unknown []string
+
+	for _, name := range names {
+		id, ok := resolved[name]
+		switch {
+		case !ok:
+			unknown = append(unknown, name)
+		case !slices.Contains(ids, id):
+			ids = append(ids, id)
+		}
+	}
+
+	if unknown != nil {
+		v.AddError(key, "must only contain known styles or their synonyms (unknown: "+strings.Join(unknown, ", ")+")")
+	}
+
+	return ids, nil
+}
+
+// canonicalTuneType returns the canonical form of a tune type as typed, or nil if it
+// is empty.
+func canonicalTuneType(s string) *string {
+	tuneType := data.Canonicalize(s)
+	if tuneType == "" {
+		return nil
+	}
+
+	return &tuneType
+}
+
+// readStyleParent checks that the style's parent, if it has one, exists.
+func (app *application) readStyleParent(v *validator.Validator, style *data.Style) error {
+	if style.ParentID == nil {
+		return nil
+	}
+
+	_, err := app.models.Styles.Get(*style.ParentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("parent_id", "must be the ID of an existing style")
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (app *application) createStyleHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ID       string   `json:"id"`
+		Name     string   `json:"name"`
+		ParentID *string  `json:"parent_id"`
+		Synonyms []string `json:"synonyms"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	style := &data.Style{
+		ID:       input.ID,
+		Name:     input.Name,
+		ParentID: input.ParentID,
+		Synonyms: input.Synonyms,
+	}
+
+	// The ID defaults to the canonical form of the name
+	if style.ID == "" {
+		style.ID = data.Canonicalize(style.Name)
+	}
+
+	if style.Synonyms == nil {
+		style.Synonyms = []string{}
+	}
+
+	v := validator.New()
+
+	if data.ValidateStyle(v, style); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.readStyleParent(v, style)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Styles.Insert(style)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateStyle):
+			v.AddError("name", "a style with this ID or name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateSynonym):
+			v.AddError("synonyms", "must not contain a synonym of another style")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/styles/%s", style.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"style": style}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showStyleHandler(w http.ResponseWriter, r *http.Request) {
+	style, err := app.models.Styles.Get(app.readStringParam(r, "id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"style": style}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateStyleHandler(w http.ResponseWriter, r *http.Request) {
+	style, err := app.models.Styles.Get(app.readStringParam(r, "id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Name     *string  `json:"name"`
+		ParentID *string  `json:"parent_id"`
+		Synonyms []string `json:"synonyms"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		style.Name = *input.Name
+	}
+
+	if input.ParentID != nil {
+		style.ParentID = input.ParentID
+
+		// An empty string makes the style a top-level one
+		if *input.ParentID == "" {
+			style.ParentID = nil
+		}
+	}
+
+	if input.Synonyms != nil {
+		style.Synonyms = input.Synonyms
+	}
+
+	v := validator.New()
+
+	if data.ValidateStyle(v, style); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.readStyleParent(v, style)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Styles.Update(style)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateStyle):
+			v.AddError("name", "a style with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateSynonym):
+			v.AddError("synonyms", "must not contain a synonym of another style")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrStyleCycle):
+			v.AddError("parent_id", "must not be the style itself or a style under it")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"style": style}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteStyleHandler(w http.ResponseWriter, r *http.Request) {
+	id := app.readStringParam(r, "id")
+
+	err := app.models.Styles.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrStyleInUse):
+			tunes, children, err := app.models.Styles.CountUses(id)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			v := validator.New()
+			v.AddError("style", fmt.Sprintf("is used by %d tune(s) and has %d style(s) under it, and cannot be deleted until it is removed from them", tunes, children))
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "style successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listStylesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name     string
+		ParentID string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Name = app.readString(qs, "name", "")
+	input.ParentID = app.readString(qs, "under", "")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "name")
+	input.Filters.SortSafelist = []string{"id", "name", "-id", "-name"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	styles, metadata, err := app.models.Styles.GetAll(input.Name, input.ParentID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"styles": styles, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listUnmatchedStylesHandler reports the free-text styles left on tunes that could
+// not be mapped onto the taxonomy. Adding them as a style or synonym maps them.
+func (app *application) listUnmatchedStylesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "style")
+	input.Filters.SortSafelist = []string{"style", "title", "-style", "-title"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	unmatched, metadata, err := app.models.Styles.GetUnmatched(input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"unmatched_styles": unmatched, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
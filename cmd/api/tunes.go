@@ -1,22 +1,67 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 
+	"jambuster.njvanhaute.com/internal/abc"
 	"jambuster.njvanhaute.com/internal/data"
 	"jambuster.njvanhaute.com/internal/validator"
 )
 
+// tempoInput is a tune's tempo as given in a request body, which only takes the minimum
+// and maximum as the beat unit follows the time signature. Set tells an explicit null,
+// which removes the stored tempo on update, apart from a tempo that was not given.
+type tempoInput struct {
+	Set   bool
+	Tempo *data.Tempo
+}
+
+func (t *tempoInput) UnmarshalJSON(b []byte) error {
+	t.Set = true
+
+	if string(b) == "null" {
+		t.Tempo = nil
+		return nil
+	}
+
+	var input struct {
+		Min int `json:"min"`
+		Max int `json:"max"`
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(&input)
+	if err != nil {
+		return err
+	}
+
+	t.Tempo = &data.Tempo{Min: input.Min, Max: input.Max}
+
+	return nil
+}
+
 func (app *application) createTuneHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Title         string             `json:"title"`
 		Styles        []string           `json:"styles"`
+		TuneType      *string            `json:"tune_type"`
 		Keys          []data.Key         `json:"keys"`
 		TimeSignature data.TimeSignature `json:"time_signature"`
+		Tempo         tempoInput         `json:"tempo"`
+		Tunings       []tuneTuningInput  `json:"tunings"`
 		Structure     string             `json:"structure"`
-		HasLyrics     bool               `json:"has_lyrics"`
+		HasLyrics     *bool              `json:"has_lyrics"` // Accepted but ignored, it follows the tune's lyrics
+		ABC           *string            `json:"abc"`
+		ComposerIDs   []int64            `json:"composer_ids"`
+		SourceIDs     []int64            `json:"source_ids"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -27,20 +72,48 @@ func (app *application) createTuneHandler(w http.ResponseWriter, r *http.Request
 
 	tune := &data.Tune{
 		Title:         input.Title,
-		Styles:        input.Styles,
 		Keys:          input.Keys,
 		TimeSignature: input.TimeSignature,
+		Tempo:         input.Tempo.Tempo,
 		Structure:     input.Structure,
-		HasLyrics:     input.HasLyrics,
+		ABC:           input.ABC,
+	}
+
+	if input.TuneType != nil {
+		tune.TuneType = canonicalTuneType(*input.TuneType)
 	}
 
 	v := validator.New()
 
+	tune.Styles, err = app.readStyles(v, "styles", input.Styles)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.readCredits(v, tune, input.ComposerIDs, input.SourceIDs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.readTunings(v, tune, input.Tunings)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	if data.ValidateTune(v, tune); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
+	aliasOf, err := app.models.TuneAliases.GetTuneIDsForTitle(tune.Title)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	err = app.models.Tunes.Insert(tune)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -50,7 +123,19 @@ func (app *application) createTuneHandler(w http.ResponseWriter, r *http.Request
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/tunes/%d", tune.ID))
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"tune": tune}, headers)
+	env := envelope{"tune": tune}
+
+	// The tune is still created, since different tunes can share a name, but the
+	// client is told in case it is a duplicate of a tune known by another title
+	if len(aliasOf) > 0 {
+		var warnings []string
+		for _, id := range aliasOf {
+			warnings = append(warnings, fmt.Sprintf("title is an alias of tune %d", id))
+		}
+		env["warnings"] = warnings
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -75,12 +160,102 @@ func (app *application) showTuneHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"tune": tune}, nil)
+	tune.Sets, err = app.models.Sets.GetAllForTune(tune.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Vary", "Accept")
+
+	if app.negotiateContentType(r, "application/json", "text/vnd.abc") == "text/vnd.abc" {
+		if tune.ABC == nil {
+			app.notAcceptableResponse(w, r)
+			return
+		}
+
+		file, err := abcFile(tune)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		headers.Set("Content-Disposition", fmt.Sprintf("inline; filename=\"tune-%d.abc\"", tune.ID))
+
+		err = app.writeText(w, http.StatusOK, "text/vnd.abc; charset=utf-8", file, headers)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tune": tune}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// readCredits replaces the tune's composers and sources with the ones with the given
+// IDs, adding a validation error for any ID that does not exist. A nil slice leaves the
+// corresponding credits unchanged and an empty one removes them.
+func (app *application) readCredits(v *validator.Validator, tune *data.Tune, composerIDs, sourceIDs []int64) error {
+	if composerIDs != nil {
+		composers, err := app.models.Composers.GetByIDs(composerIDs)
+		if err != nil {
+			return err
+		}
+
+		v.Check(validator.Unique(composerIDs), "composer_ids", "must not contain duplicate values")
+		v.Check(len(composers) == len(composerIDs), "composer_ids", "must only contain IDs of existing composers")
+		tune.Composers = composers
+	}
+
+	if sourceIDs != nil {
+		sources, err := app.models.Sources.GetByIDs(sourceIDs)
+		if err != nil {
+			return err
+		}
+
+		v.Check(validator.Unique(sourceIDs), "source_ids", "must not contain duplicate values")
+		v.Check(len(sources) == len(sourceIDs), "source_ids", "must only contain IDs of existing sources")
+		tune.Sources = sources
+	}
+
+	return nil
+}
+
+func abcFile(tune *data.Tune) (string, error) {
+	abcTune := &abc.Tune{
+		Number: int(tune.ID),
+		Titles: []string{tune.Title},
+		Meter:  tune.TimeSignature.String(),
+	}
+
+	if tune.ABC != nil {
+		abcTune.Body = *tune.ABC
+	}
+
+	if tune.TuneType != nil {
+		abcTune.Rhythm = strings.ReplaceAll(*tune.TuneType, "_", " ")
+	}
+
+	for i, key := range tune.Keys {
+		field, err := abc.KeyField(key.String())
+		if err != nil {
+			return "", err
+		}
+
+		if i == 0 {
+			abcTune.Key = field
+		} else {
+			abcTune.Notes = append(abcTune.Notes, fmt.Sprintf("Also played in %s", key))
+		}
+	}
+
+	return abc.Format(abcTune), nil
+}
+
 func (app *application) updateTuneHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil {
@@ -102,10 +277,16 @@ func (app *application) updateTuneHandler(w http.ResponseWriter, r *http.Request
 	var input struct {
 		Title         *string             `json:"title"`
 		Styles        []string            `json:"styles"`
+		TuneType      *string             `json:"tune_type"`
 		Keys          []data.Key          `json:"keys"`
 		TimeSignature *data.TimeSignature `json:"time_signature"`
+		Tempo         tempoInput          `json:"tempo"`
+		Tunings       []tuneTuningInput   `json:"tunings"`
 		Structure     *string             `json:"structure"`
-		HasLyrics     *bool               `json:"has_lyrics"`
+		HasLyrics     *bool               `json:"has_lyrics"` // Accepted but ignored, it follows the tune's lyrics
+		ABC           *string             `json:"abc"`
+		ComposerIDs   []int64             `json:"composer_ids"`
+		SourceIDs     []int64             `json:"source_ids"`
 	}
 
 	err = app.readJSON(w, r, &input)
@@ -118,8 +299,9 @@ func (app *application) updateTuneHandler(w http.ResponseWriter, r *http.Request
 		tune.Title = *input.Title
 	}
 
-	if input.Styles != nil {
-		tune.Styles = input.Styles
+	if input.TuneType != nil {
+		// An empty string removes the tune type
+		tune.TuneType = canonicalTuneType(*input.TuneType)
 	}
 
 	if input.Keys != nil {
@@ -130,16 +312,46 @@ func (app *application) updateTuneHandler(w http.ResponseWriter, r *http.Request
 		tune.TimeSignature = *input.TimeSignature
 	}
 
+	if input.Tempo.Set {
+		// null removes the stored tempo
+		tune.Tempo = input.Tempo.Tempo
+	}
+
 	if input.Structure != nil {
 		tune.Structure = *input.Structure
 	}
 
-	if input.HasLyrics != nil {
-		tune.HasLyrics = *input.HasLyrics
+	if input.ABC != nil {
+		tune.ABC = input.ABC
+
+		// An empty string removes the stored ABC body
+		if *input.ABC == "" {
+			tune.ABC = nil
+		}
 	}
 
 	v := validator.New()
 
+	if input.Styles != nil {
+		tune.Styles, err = app.readStyles(v, "styles", input.Styles)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.readCredits(v, tune, input.ComposerIDs, input.SourceIDs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.readTunings(v, tune, input.Tunings)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	if data.ValidateTune(v, tune); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
@@ -174,10 +386,14 @@ func (app *application) deleteTuneHandler(w http.ResponseWriter, r *http.Request
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+			return
+		case errors.Is(err, data.ErrStorageCleanup):
+			// The tune is gone, so only the leftover files need attention
+			app.logError(r, err)
 		default:
 			app.serverErrorResponse(w, r, err)
+			return
 		}
-		return
 	}
 
 	err = app.writeJSON(w, http.StatusOK, envelope{"message": "tune successfully deleted"}, nil)
@@ -186,14 +402,179 @@ func (app *application) deleteTuneHandler(w http.ResponseWriter, r *http.Request
 	}
 }
 
+func (app *application) transposeTuneHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	tune, err := app.models.Tunes.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Key       *data.Key `json:"key"`
+		Semitones *int      `json:"semitones"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if validateTransposeTarget(v, input.Key, input.Semitones); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	t := transpose(tune.Keys, input.Key, input.Semitones)
+
+	tune.Keys = nil
+	for _, change := range t.KeyChanges {
+		tune.Keys = append(tune.Keys, change.To)
+	}
+
+	// The melody itself is not transposed, so the ABC body is left out of the response
+	tune.ABC = nil
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tune": tune, "transposition": t}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readTuneFilters reads the tune search criteria shared by the endpoints that list tunes
+// from the query string, adding a validation error for any that are malformed or refer
+// to unknown styles.
+func (app *application) readTuneFilters(r *http.Request, qs url.Values, v *validator.Validator) (data.TuneFilters, error) {
+	var tf data.TuneFilters
+	var err error
+
+	tf.Title = app.readString(qs, "title", "")
+
+	tf.Styles, err = app.readStyles(v, "styles", app.readCSV(qs, "styles", []string{}))
+	if err != nil {
+		return tf, err
+	}
+
+	if s := app.readString(qs, "type", ""); s != "" {
+		tf.TuneType = data.Canonicalize(s)
+		v.Check(validator.PermittedValue(tf.TuneType, data.TuneTypes...), "type", "must be one of "+strings.Join(data.TuneTypes, ", "))
+	}
+
+	for _, s := range app.readCSV(qs, "keys", []string{}) {
+		key, err := data.ParseKey(s)
+		if err != nil {
+			v.AddError("keys", "must be a comma-separated list of valid keys")
+			break
+		}
+		tf.Keys = append(tf.Keys, key)
+	}
+
+	if s := app.readString(qs, "key_signature", ""); s != "" {
+		signature, err := data.ParseKeySignature(s)
+		if err != nil {
+			v.AddError("key_signature", "must be a key signature such as 0, 1# or 2b")
+		} else {
+			tf.KeySignature = &signature
+		}
+	}
+
+	if s := app.readString(qs, "key_family", ""); s != "" {
+		key, err := data.ParseKey(s)
+
+		switch {
+		case err != nil:
+			v.AddError("key_family", "must be a valid key")
+		case tf.KeySignature != nil:
+			v.AddError("key_family", "must not be provided together with key_signature")
+		default:
+			signature := key.Signature()
+			tf.KeySignature = &signature
+		}
+	}
+
+	enharmonic := false
+	tf.Enharmonic = *app.readBool(qs, "enharmonic", &enharmonic, v)
+
+	if s := app.readString(qs, "time_signature", ""); s != "" {
+		timeSignature, err := data.ParseTimeSignature(s)
+		if err != nil {
+			v.AddError("time_signature", "must be a valid time signature such as 4/4 or 6/8")
+		}
+		tf.TimeSignature = timeSignature.String()
+	}
+
+	tf.MeterClass = app.readString(qs, "meter_class", "")
+	if tf.MeterClass != "" {
+		v.Check(validator.PermittedValue(tf.MeterClass, data.MeterClasses...), "meter_class", "must be one of "+strings.Join(data.MeterClasses, ", "))
+	}
+
+	tf.TempoMin = app.readInt(qs, "tempo_min", 0, v)
+	tf.TempoMax = app.readInt(qs, "tempo_max", 0, v)
+	v.Check(tf.TempoMin >= 0, "tempo_min", "must not be negative")
+	v.Check(tf.TempoMax >= 0, "tempo_max", "must not be negative")
+	v.Check(tf.TempoMax == 0 || tf.TempoMin <= tf.TempoMax, "tempo_max", "must not be less than tempo_min")
+
+	tf.Structure = app.readString(qs, "structure", "")
+	tf.PartCount = app.readInt(qs, "parts", 0, v)
+	v.Check(tf.PartCount >= 0, "parts", "must not be negative")
+	tf.Crooked = app.readBool(qs, "crooked", nil, v)
+	tf.HasLyrics = app.readBool(qs, "has_lyrics", nil, v)
+	tf.Lyrics = app.readString(qs, "lyrics", "")
+	tf.ComposerID = int64(app.readInt(qs, "composer", 0, v))
+	tf.SourceID = int64(app.readInt(qs, "source", 0, v))
+	v.Check(tf.ComposerID >= 0, "composer", "must not be negative")
+	v.Check(tf.SourceID >= 0, "source", "must not be negative")
+	tf.Traditional = app.readBool(qs, "traditional", nil, v)
+
+	tf.Instrument = app.readString(qs, "instrument", "")
+	if tf.Instrument != "" {
+		v.Check(validator.PermittedValue(tf.Instrument, data.Instruments...), "instrument", "must be one of "+strings.Join(data.Instruments, ", "))
+	}
+
+	// The tuning can be given by name or notes (ex: Cross A or AEAE), and must be
+	// one known for the instrument if that is given too
+	if s := app.readString(qs, "tuning", ""); s != "" {
+		tunings, err := app.models.Tunings.Find(tf.Instrument, s)
+		if err != nil {
+			return tf, err
+		}
+
+		if len(tunings) == 0 && tf.Instrument != "" {
+			v.AddError("tuning", "must be a known "+tf.Instrument+" tuning")
+		}
+		v.Check(len(tunings) > 0, "tuning", "must be a known tuning")
+
+		for _, tuning := range tunings {
+			tf.TuningIDs = append(tf.TuningIDs, tuning.ID)
+		}
+	}
+
+	tf.UserID = app.contextGetUser(r).ID
+	tf.InRepertoire = app.readBool(qs, "in_my_repertoire", nil, v)
+	tf.Proficiency = app.readString(qs, "proficiency", "")
+	if tf.Proficiency != "" {
+		v.Check(validator.PermittedValue(tf.Proficiency, data.ProficiencyLevels...), "proficiency", "must be one of "+strings.Join(data.ProficiencyLevels, ", "))
+	}
+
+	return tf, nil
+}
+
 func (app *application) listTunesHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title         string
-		Styles        []string
-		Keys          []string
-		TimeSignature string
-		Structure     string
-		HasLyrics     *bool
+		data.TuneFilters
 		data.Filters
 	}
 
@@ -201,26 +582,78 @@ func (app *application) listTunesHandler(w http.ResponseWriter, r *http.Request)
 
 	qs := r.URL.Query()
 
-	input.Title = app.readString(qs, "title", "")
-	input.Styles = app.readCSV(qs, "styles", []string{})
-	input.Keys = app.readCSV(qs, "keys", []string{})
-	input.TimeSignature = app.readString(qs, "time_signature", "")
-	input.Structure = app.readString(qs, "structure", "")
-	input.HasLyrics = app.readBool(qs, "has_lyrics", nil, v)
+	var err error
+
+	input.TuneFilters, err = app.readTuneFilters(r, qs, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 
 	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafelist = []string{"id", "title", "time_signature", "structure", "has_lyrics",
-		"-id", "-title", "-time_signature", "-structure", "-has_lyrics"}
+	input.Filters.SortSafelist = []string{"id", "title", "time_signature", "tempo_min", "tempo_max", "structure", "has_lyrics", "relevance",
+		"-id", "-title", "-time_signature", "-tempo_min", "-tempo_max", "-structure", "-has_lyrics"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	tunes, metadata, err := app.models.Tunes.GetAll(input.TuneFilters, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tunes": tunes, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listSimilarTunesHandler recommends other tunes for someone who likes this one, ranked
+// by how much they have in common with it and giving the reasons for each.
+func (app *application) listSimilarTunesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-score")
+	input.Filters.SortSafelist = []string{"score", "title", "-score", "-title"}
 
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	tunes, metadata, err := app.models.Tunes.GetAll(input.Title, input.Styles, input.Keys, input.TimeSignature, input.Structure, input.HasLyrics, input.Filters)
+	tune, err := app.models.Tunes.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	tunes, metadata, err := app.models.Tunes.GetSimilar(tune, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"jambuster.njvanhaute.com/internal/data"
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+// tuneTuningInput links a tune to a tuning, naming the instrument so that a tuning
+// for the wrong instrument is caught rather than silently accepted.
+type tuneTuningInput struct {
+	Instrument string `json:"instrument"`
+	TuningID   int64  `json:"tuning_id"`
+}
+
+// readTunings sets the tune's tunings from the given links, adding a validation error
+// for any tuning that does not exist or is not for the given instrument. A nil slice
+// leaves the tune's tunings unchanged.
+func (app *application) readTunings(v *validator.Validator, tune *data.Tune, inputs []tuneTuningInput) error {
+	if inputs == nil {
+		return nil
+	}
+
+	ids := []int64{}
+	for _, input := range inputs {
+		ids = append(ids, input.TuningID)
+	}
+
+	tunings, err := app.models.Tunings.GetByIDs(ids)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[int64]data.Tuning)
+	for _, tuning := range tunings {
+		byID[tuning.ID] = tuning
+	}
+
+	v.Check(validator.Unique(ids), "tunings", "must not contain the same tuning twice")
+
+	tune.Tunings = []data.Tuning{}
+
+	for _, input := range inputs {
+		tuning, ok := byID[input.TuningID]
+
+		switch {
+		case input.Instrument == "":
+			v.AddError("tunings", "must give the instrument of each tuning")
+		case !ok:
+			v.AddError("tunings", fmt.Sprintf("must only contain existing tunings (tuning %d does not exist)", input.TuningID))
+		case tuning.Instrument != input.Instrument:
+			v.AddError("tunings", fmt.Sprintf("tuning %d is a %s tuning, not a %s one", tuning.ID, tuning.Instrument, input.Instrument))
+		default:
+			tune.Tunings = append(tune.Tunings, tuning)
+		}
+	}
+
+	return nil
+}
+
+func (app *application) createTuningHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Instrument string `json:"instrument"`
+		Name       string `json:"name"`
+		Notes      string `json:"notes"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	tuning := &data.Tuning{
+		Instrument: input.Instrument,
+		Name:       input.Name,
+		Notes:      input.Notes,
+	}
+
+	v := validator.New()
+
+	if data.ValidateTuning(v, tuning); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Tunings.Insert(tuning)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateTuning):
+			v.AddError("name", "a tuning with this name already exists for the instrument")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/tunings/%d", tuning.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"tuning": tuning}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showTuningHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	tuning, err := app.models.Tunings.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tuning": tuning}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateTuningHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	tuning, err := app.models.Tunings.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Instrument *string `json:"instrument"`
+		Name       *string `json:"name"`
+		Notes      *string `json:"notes"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Instrument != nil {
+		tuning.Instrument = *input.Instrument
+	}
+
+	if input.Name != nil {
+		tuning.Name = *input.Name
+	}
+
+	if input.Notes != nil {
+		tuning.Notes = *input.Notes
+	}
+
+	v := validator.New()
+
+	if data.ValidateTuning(v, tuning); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Tunings.Update(tuning)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateTuning):
+			v.AddError("name", "a tuning with this name already exists for the instrument")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrTuningInUse):
+			count, err := app.models.Tunings.CountTunes(id)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			v.AddError("instrument", fmt.Sprintf("cannot be changed while the tuning is used by %d tune(s)", count))
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tuning": tuning}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteTuningHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Tunings.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrTuningInUse):
+			count, err := app.models.Tunings.CountTunes(id)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			v := validator.New()
+			v.AddError("tuning", fmt.Sprintf("is used by %d tune(s) and cannot be deleted until it is removed from them", count))
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "tuning successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listTuningsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Instrument string
+		Name       string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Instrument = app.readString(qs, "instrument", "")
+	if input.Instrument != "" {
+		v.Check(validator.PermittedValue(input.Instrument, data.Instruments...), "instrument", "must be one of "+strings.Join(data.Instruments, ", "))
+	}
+
+	input.Name = app.readString(qs, "name", "")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "instrument")
+	input.Filters.SortSafelist = []string{"id", "instrument", "name", "-id", "-instrument", "-name"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	tunings, metadata, err := app.models.Tunings.GetAll(input.Instrument, input.Name, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tunings": tunings, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,562 @@
+package abc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrNoTunes      = errors.New("no tunes found")
+	ErrInvalidKey   = errors.New("invalid key field")
+	ErrInvalidMeter = errors.New("invalid meter field")
+)
+
+// Tune holds the header fields and the raw body of a single tune from an ABC file.
+type Tune struct {
+	Number     int      // Reference number from the X: field
+	Titles     []string // Every T: field in the header, the first being the main title
+	Key        string   // Raw K: field (ex: Gmix)
+	Meter      string   // Raw M: field (ex: 6/8)
+	UnitLength string   // Raw L: field (ex: 1/8)
+	Rhythm     string   // Raw R: field (ex: reel)
+	Parts      string   // Raw P: field from the header (ex: AABB)
+	Notes      []string // Every N: field in the header
+	Body       string   // Everything following the K: field
+	Words      []string // Text of every W: field, the words printed below the tune
+	HasWords   bool     // Whether or not the tune has W: or w: lyric lines
+}
+
+func (t *Tune) Title() string {
+	if len(t.Titles) == 0 {
+		return ""
+	}
+
+	return t.Titles[0]
+}
+
+// Parse splits an ABC file into its tunes. Tunebooks are expected to start each tune
+// with an X: field, while a file without any X: field is treated as a single tune.
+func Parse(src string) ([]*Tune, error) {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	hasReferenceNumbers := false
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "X:") {
+			hasReferenceNumbers = true
+			break
+		}
+	}
+
+	var (
+		tunes  []*Tune
+		tune   *Tune
+		inBody bool
+		body   []string
+	)
+
+	if !hasReferenceNumbers {
+		tune = &Tune{Number: 1}
+	}
+
+	finish := func() {
+		if tune != nil && (tune.Key != "" || len(tune.Titles) > 0 || len(body) > 0) {
+			tune.Body = strings.TrimSpace(strings.Join(body, "\n"))
+			tunes = append(tunes, tune)
+		}
+
+		tune, inBody, body = nil, false, nil
+	}
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "%") {
+			continue
+		}
+
+		if isField(trimmed) && trimmed[0] == 'X' {
+			finish()
+			number, _ := strconv.Atoi(strings.TrimSpace(trimmed[2:]))
+			tune = &Tune{Number: number}
+			continue
+		}
+
+		if trimmed == "" {
+			if inBody || hasReferenceNumbers {
+				finish()
+			}
+			continue
+		}
+
+		if tune == nil {
+			continue
+		}
+
+		if !inBody && isField(trimmed) {
+			value := strings.TrimSpace(trimmed[2:])
+
+			switch trimmed[0] {
+			case 'T':
+				tune.Titles = append(tune.Titles, value)
+			case 'M':
+				tune.Meter = value
+			case 'L':
+				tune.UnitLength = value
+			case 'R':
+				tune.Rhythm = value
+			case 'P':
+				tune.Parts = value
+			case 'N':
+				tune.Notes = append(tune.Notes, value)
+			case 'W':
+				tune.Words = append(tune.Words, value)
+				tune.HasWords = true
+			case 'w':
+				tune.HasWords = true
+			case 'K':
+				tune.Key = value
+				inBody = true
+			}
+			continue
+		}
+
+		inBody = true
+
+		if isBodyField(trimmed) && (trimmed[0] == 'W' || trimmed[0] == 'w') {
+			if trimmed[0] == 'W' {
+				tune.Words = append(tune.Words, strings.TrimSpace(trimmed[2:]))
+			}
+			tune.HasWords = true
+		}
+
+		body = append(body, line)
+	}
+
+	finish()
+
+	if len(tunes) == 0 {
+		return nil, ErrNoTunes
+	}
+
+	return tunes, nil
+}
+
+// KeyName converts an ABC key field such as "Gmix", "Ador" or "F#m" into the
+// "<tonic> <mode>" spelling used by Jambuster (ex: "G mixolydian").
+func KeyName(field string) (string, error) {
+	s := strings.TrimSpace(field)
+	if s == "" {
+		return "", ErrInvalidKey
+	}
+
+	if token := strings.Fields(s)[0]; strings.EqualFold(token, "HP") {
+		return "A mixolydian", nil
+	}
+
+	tonic := strings.ToUpper(s[:1])
+	if !strings.Contains("ABCDEFG", tonic) {
+		return "", ErrInvalidKey
+	}
+
+	rest := s[1:]
+	if len(rest) > 0 && (rest[0] == '#' || rest[0] == 'b') {
+		tonic += rest[:1]
+		rest = rest[1:]
+	}
+
+	modeWord := ""
+	if tokens := strings.Fields(rest); len(tokens) > 0 && !strings.Contains(tokens[0], "=") {
+		modeWord = strings.ToLower(tokens[0])
+	}
+
+	if len(modeWord) > 3 {
+		modeWord = modeWord[:3]
+	}
+
+	modes := map[string]string{
+		"":    "major",
+		"maj": "major",
+		"ion": "major",
+		"m":   "minor",
+		"min": "minor",
+		"aeo": "minor",
+		"dor": "dorian",
+		"phr": "phrygian",
+		"lyd": "lydian",
+		"mix": "mixolydian",
+		"loc": "locrian",
+	}
+
+	mode, ok := modes[modeWord]
+	if !ok {
+		return "", ErrInvalidKey
+	}
+
+	return fmt.Sprintf("%s %s", tonic, mode), nil
+}
+
+// TimeSignature converts an ABC meter field into a "<beats>/<unit>" time signature,
+// expanding the common time ("C") and cut time ("C|") symbols.
+func TimeSignature(field string) (string, error) {
+	s := strings.TrimSpace(field)
+
+	switch s {
+	case "C":
+		return "4/4", nil
+	case "C|":
+		return "2/2", nil
+	}
+
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return "", ErrInvalidMeter
+	}
+
+	beats, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || beats < 1 {
+		return "", ErrInvalidMeter
+	}
+
+	unit, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil || unit < 1 {
+		return "", ErrInvalidMeter
+	}
+
+	return fmt.Sprintf("%d/%d", beats, unit), nil
+}
+
+// Structure returns the tune's form as a string of part letters (ex: AABB). The
+// header P: field is used when present, otherwise the parts are inferred from the
+// repeat signs and double bar lines in the body.
+func (t *Tune) Structure() string {
+	if t.Parts != "" {
+		if structure, _ := expandParts(t.Parts, 0); structure != "" {
+			return structure
+		}
+	}
+
+	return sectionsFromBody(t.Body)
+}
+
+// expandParts expands the P: field syntax, where a number repeats the preceding
+// part or parenthesised group, so "A2B" becomes "AAB" and "(AB)2" becomes "ABAB".
+func expandParts(s string, i int) (string, int) {
+	var sb strings.Builder
+	last := ""
+
+	for i < len(s) {
+		c := s[i]
+
+		switch {
+		case c >= 'A' && c <= 'Z':
+			last = string(c)
+			sb.WriteString(last)
+			i++
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+
+			n, _ := strconv.Atoi(s[i:j])
+			if last != "" && n > 1 {
+				sb.WriteString(strings.Repeat(last, min(n, 10)-1))
+			}
+
+			last = ""
+			i = j
+		case c == '(':
+			group, next := expandParts(s, i+1)
+			last = group
+			sb.WriteString(group)
+			i = next
+		case c == ')':
+			return sb.String(), i + 1
+		default:
+			i++
+		}
+	}
+
+	return sb.String(), i
+}
+
+func sectionsFromBody(body string) string {
+	var counts []int
+
+	hasNotes, repeated, bars := false, false, 0
+
+	closeSection := func() {
+		if hasNotes {
+			count := 1
+			if repeated {
+				count = 2
+			}
+			counts = append(counts, count)
+		}
+
+		hasNotes, repeated, bars = false, false, 0
+	}
+
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if isBodyField(line) {
+			continue
+		}
+
+	scan:
+		for i := 0; i < len(line); i++ {
+			rest := line[i:]
+
+			switch {
+			case line[i] == '%':
+				break scan
+			case line[i] == '"' || line[i] == '!':
+				if end := strings.IndexByte(line[i+1:], line[i]); end >= 0 {
+					i += end + 1
+				}
+			case len(rest) > 2 && rest[0] == '[' && isLetter(rest[1]) && rest[2] == ':':
+				if end := strings.IndexByte(rest, ']'); end >= 0 {
+					i += end
+				}
+			case strings.HasPrefix(rest, "::"):
+				repeated = true
+				closeSection()
+				repeated = true
+				i++
+			case strings.HasPrefix(rest, ":|"):
+				j := i + 2
+				for j < len(line) && (line[j] == '|' || line[j] == ']' || line[j] == ' ') {
+					j++
+				}
+
+				repeated = true
+				if strings.HasPrefix(line[j:], "2") || strings.HasPrefix(line[j:], "[2") {
+					i = j - 1
+					continue
+				}
+
+				closeSection()
+				if j < len(line) && line[j] == ':' {
+					repeated = true
+					j++
+				}
+				i = j - 1
+			case strings.HasPrefix(rest, "|:"):
+				// Notes before the first complete bar are a pickup into the repeat
+				if bars > 0 {
+					closeSection()
+				} else {
+					hasNotes = false
+				}
+				repeated = true
+				i++
+			case strings.HasPrefix(rest, "|]"), strings.HasPrefix(rest, "[|"):
+				closeSection()
+				i++
+			case strings.HasPrefix(rest, "||"):
+				closeSection()
+			case line[i] == '|':
+				bars++
+			case strings.IndexByte("ABCDEFGabcdefg", line[i]) >= 0:
+				hasNotes = true
+			}
+		}
+	}
+
+	closeSection()
+
+	var sb strings.Builder
+	for i, count := range counts {
+		part := string(rune('A' + min(i, 25)))
+		sb.WriteString(strings.Repeat(part, count))
+	}
+
+	return sb.String()
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+}
+
+func isField(line string) bool {
+	return len(line) >= 2 && isLetter(line[0]) && line[1] == ':'
+}
+
+// isBodyField reports whether a body line is an information field rather than music.
+// Only the fields allowed in a tune body are recognised so that lines of notes such
+// as "g:|" are not mistaken for fields.
+func isBodyField(line string) bool {
+	return isField(line) && strings.IndexByte("IKLMmNPQRrsTUVWw", line[0]) >= 0
+}
+
+// KeyField converts a "<tonic> <mode>" key name (ex: "G mixolydian") into its ABC
+// K: field spelling (ex: "Gmix").
+func KeyField(name string) (string, error) {
+	tonic, mode, found := strings.Cut(name, " ")
+	if !found || tonic == "" {
+		return "", ErrInvalidKey
+	}
+
+	suffixes := map[string]string{
+		"major":      "",
+		"minor":      "m",
+		"dorian":     "dor",
+		"phrygian":   "phr",
+		"lydian":     "lyd",
+		"mixolydian": "mix",
+		"locrian":    "loc",
+	}
+
+	suffix, ok := suffixes[mode]
+	if !ok {
+		return "", ErrInvalidKey
+	}
+
+	return tonic + suffix, nil
+}
+
+// Format renders the tune as a complete ABC file, writing the header fields in the
+// order recommended by the standard (X: first and K: last) followed by the body.
+func Format(t *Tune) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "X:%d\n", t.Number)
+
+	for _, title := range t.Titles {
+		fmt.Fprintf(&sb, "T:%s\n", title)
+	}
+
+	if t.Meter != "" {
+		fmt.Fprintf(&sb, "M:%s\n", t.Meter)
+	}
+
+	if t.UnitLength != "" {
+		fmt.Fprintf(&sb, "L:%s\n", t.UnitLength)
+	}
+
+	if t.Rhythm != "" {
+		fmt.Fprintf(&sb, "R:%s\n", t.Rhythm)
+	}
+
+	for _, note := range t.Notes {
+		fmt.Fprintf(&sb, "N:%s\n", note)
+	}
+
+	if t.Parts != "" {
+		fmt.Fprintf(&sb, "P:%s\n", t.Parts)
+	}
+
+	fmt.Fprintf(&sb, "K:%s\n", t.Key)
+
+	if body := strings.TrimSpace(t.Body); body != "" {
+		sb.WriteString(body)
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+// ValidateBody performs basic well-formedness checks on the body of a tune: it must
+// contain music, must not start a new tune, and chord symbols, decorations, chords
+// and grace notes must be closed on the line they are opened.
+func ValidateBody(body string) error {
+	hasNotes := false
+
+	for n, line := range strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if trimmed == "" || strings.HasPrefix(trimmed, "%") {
+			continue
+		}
+
+		if isField(trimmed) {
+			if !isBodyField(trimmed) {
+				return fmt.Errorf("line %d: %c: field is not allowed in a tune body", n+1, trimmed[0])
+			}
+			continue
+		}
+
+		if i := strings.IndexByte(trimmed, '%'); i >= 0 {
+			trimmed = trimmed[:i]
+		}
+
+		if strings.Count(trimmed, `"`)%2 != 0 {
+			return fmt.Errorf("line %d: unterminated chord symbol or annotation", n+1)
+		}
+
+		if strings.Count(trimmed, "!")%2 != 0 {
+			return fmt.Errorf("line %d: unterminated decoration", n+1)
+		}
+
+		if err := checkBrackets(trimmed); err != nil {
+			return fmt.Errorf("line %d: %w", n+1, err)
+		}
+
+		if strings.ContainsAny(stripQuoted(trimmed), "ABCDEFGabcdefgzx") {
+			hasNotes = true
+		}
+	}
+
+	if !hasNotes {
+		return errors.New("body must contain at least one note")
+	}
+
+	return nil
+}
+
+func checkBrackets(line string) error {
+	var open byte
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		switch c {
+		case '"', '!':
+			if end := strings.IndexByte(line[i+1:], c); end >= 0 {
+				i += end + 1
+			}
+		case '[', '{':
+			// [| is a bar line and [1, [2 are variant endings rather than chords
+			if c == '[' && i+1 < len(line) && (line[i+1] == '|' || (line[i+1] >= '0' && line[i+1] <= '9')) {
+				continue
+			}
+			if open != 0 {
+				return fmt.Errorf("nested %q", c)
+			}
+			open = c
+		case ']', '}':
+			if (c == ']' && open != '[') || (c == '}' && open != '{') {
+				// A lone ] is valid as part of a closing bar line such as |]
+				if c == ']' && open == 0 && i > 0 && line[i-1] == '|' {
+					continue
+				}
+				return fmt.Errorf("unexpected %q", c)
+			}
+			open = 0
+		}
+	}
+
+	if open != 0 {
+		return fmt.Errorf("unclosed %q", open)
+	}
+
+	return nil
+}
+
+func stripQuoted(line string) string {
+	var sb strings.Builder
+
+	for i := 0; i < len(line); i++ {
+		if line[i] == '"' || line[i] == '!' {
+			if end := strings.IndexByte(line[i+1:], line[i]); end >= 0 {
+				i += end + 1
+				continue
+			}
+		}
+		sb.WriteByte(line[i])
+	}
+
+	return sb.String()
+}
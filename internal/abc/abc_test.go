@@ -0,0 +1,221 @@
+package abc
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []Tune
+	}{
+		{
+			name: "multiple tunes",
+			src:  "X:1\nT:The Reel\nM:4/4\nK:D\n|:DEFG ABcd:|\n\nX:2\nT:The Jig\nT:The Other Name\nK:Em\nEFG ABc|\n",
+			want: []Tune{
+				{Number: 1, Titles: []string{"The Reel"}, Key: "D", Body: "|:DEFG ABcd:|"},
+				{Number: 2, Titles: []string{"The Jig", "The Other Name"}, Key: "Em", Body: "EFG ABc|"},
+			},
+		},
+		{
+			name: "text between tunes",
+			src:  "% A tunebook\nSome notes about the book\n\nX:1\nT:The Reel\nK:D\nDEFG|\n\nMore notes\n\nX:2\nT:The Jig\nK:Em\nEFG|\n",
+			want: []Tune{
+				{Number: 1, Titles: []string{"The Reel"}, Key: "D", Body: "DEFG|"},
+				{Number: 2, Titles: []string{"The Jig"}, Key: "Em", Body: "EFG|"},
+			},
+		},
+		{
+			name: "blank line ends a tune",
+			src:  "X:1\nT:The Reel\nK:D\nDEFG|\n\nABcd|\nX:2\nT:The Jig\nK:Em\nEFG|",
+			want: []Tune{
+				{Number: 1, Titles: []string{"The Reel"}, Key: "D", Body: "DEFG|"},
+				{Number: 2, Titles: []string{"The Jig"}, Key: "Em", Body: "EFG|"},
+			},
+		},
+		{
+			name: "without X field",
+			src:  "T:The Reel\r\nK:A\r\nabc|\r\ndef|\r\n",
+			want: []Tune{
+				{Number: 1, Titles: []string{"The Reel"}, Key: "A", Body: "abc|\ndef|"},
+			},
+		},
+		{
+			name: "without X field, blank line in header",
+			src:  "T:The Reel\n\nK:A\nabc|\n",
+			want: []Tune{
+				{Number: 1, Titles: []string{"The Reel"}, Key: "A", Body: "abc|"},
+			},
+		},
+		{
+			name: "without X field, blank line in body",
+			src:  "T:The Reel\nK:A\nabc|\n\ndef|\n",
+			want: []Tune{
+				{Number: 1, Titles: []string{"The Reel"}, Key: "A", Body: "abc|"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tunes, err := Parse(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(tunes) != len(tt.want) {
+				t.Fatalf("got %d tunes, want %d", len(tunes), len(tt.want))
+			}
+
+			for i, tune := range tunes {
+				want := tt.want[i]
+
+				if tune.Number != want.Number {
+					t.Errorf("tune %d: got number %d, want %d", i, tune.Number, want.Number)
+				}
+				if !slices.Equal(tune.Titles, want.Titles) {
+					t.Errorf("tune %d: got titles %q, want %q", i, tune.Titles, want.Titles)
+				}
+				if tune.Key != want.Key {
+					t.Errorf("tune %d: got key %q, want %q", i, tune.Key, want.Key)
+				}
+				if tune.Body != want.Body {
+					t.Errorf("tune %d: got body %q, want %q", i, tune.Body, want.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestParseNoTunes(t *testing.T) {
+	for _, src := range []string{"", "\n\n", "% only a comment\n"} {
+		_, err := Parse(src)
+		if !errors.Is(err, ErrNoTunes) {
+			t.Errorf("Parse(%q): got error %v, want %v", src, err, ErrNoTunes)
+		}
+	}
+}
+
+func TestKeyName(t *testing.T) {
+	tests := []struct {
+		field   string
+		want    string
+		wantErr error
+	}{
+		{"Gmix", "G mixolydian", nil},
+		{"G Mixolydian", "G mixolydian", nil},
+		{"Ador", "A dorian", nil},
+		{"F#m", "F# minor", nil},
+		{"Bb", "Bb major", nil},
+		{"Dmaj", "D major", nil},
+		{"e aeolian", "E minor", nil},
+		{"HP", "A mixolydian", nil},
+		{"", "", ErrInvalidKey},
+		{"H", "", ErrInvalidKey},
+		{"Gxyz", "", ErrInvalidKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			got, err := KeyName(tt.field)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeSignature(t *testing.T) {
+	tests := []struct {
+		field   string
+		want    string
+		wantErr error
+	}{
+		{"C", "4/4", nil},
+		{"C|", "2/2", nil},
+		{"6/8", "6/8", nil},
+		{" 3 / 4 ", "3/4", nil},
+		{"none", "", ErrInvalidMeter},
+		{"0/4", "", ErrInvalidMeter},
+		{"4/", "", ErrInvalidMeter},
+		{"2+3/8", "", ErrInvalidMeter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			got, err := TimeSignature(tt.field)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStructure(t *testing.T) {
+	tests := []struct {
+		name  string
+		parts string
+		body  string
+		want  string
+	}{
+		{"parts field", "AABB", "abc|", "AABB"},
+		{"parts field with repeat count", "A2B", "abc|", "AAB"},
+		{"parts field with repeated group", "(AB)2C", "abc|", "ABABC"},
+		{"repeats", "", "|:DEFG ABcd:|\n|:defg abc'd':|", "AABB"},
+		{"double bar lines", "", "DEFG ABcd||\ndefg abc'd'|]", "AB"},
+		{"pickup into a repeat", "", "A|:DEFG ABcd:|", "AA"},
+		{"first and second endings", "", "|:DEFG|1 ABcd:|2 dcBA||\n|:defg|abc'd':|", "AABB"},
+		{"repeat sign on both sides", "", "|:DEFG ABcd::defg abc'd':|", "AABB"},
+		{"chord symbols and inline fields", "", "|:\"D\"DEFG [K:G]ABcd:|", "AA"},
+		{"no music", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tune := &Tune{Parts: tt.parts, Body: tt.body}
+
+			if got := tune.Structure(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr bool
+	}{
+		{"valid", "|:\"D\"DEFG !trill!ABcd|[1 [DF]A {g}AB:|[2 d4|]", false},
+		{"body fields", "DEFG|\nw:some words\nP:B\nABcd|", false},
+		{"comments", "% the A part\nDEFG|ABcd| % ends here [", false},
+		{"rests only", "z4|x4|", false},
+		{"no notes", "|||", true},
+		{"only a comment", "% nothing here", true},
+		{"new tune", "DEFG|\nX:2", true},
+		{"unterminated chord symbol", "\"D DEFG|", true},
+		{"unterminated decoration", "!trill DEFG|", true},
+		{"unclosed chord", "[DFA DEFG|", true},
+		{"nested chords", "[D[FA]] DEFG|", true},
+		{"unexpected bracket", "DEFG}|", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateBody(tt.body)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("got error %v, want error: %t", err, tt.wantErr)
+			}
+		})
+	}
+}
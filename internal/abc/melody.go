@@ -0,0 +1,632 @@
+package abc
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidUnitLength = errors.New("invalid unit note length field")
+
+// Note is a single note, chord or rest of a melody.
+type Note struct {
+	Pitches []int   // MIDI note numbers sounded together, 60 being middle C, or none for a rest
+	Length  float64 // Length as a fraction of a whole note (ex: 0.125 for an eighth note)
+}
+
+// Section is a stretch of a melody closed by a repeat sign or double bar line, which
+// is how the parts of a tune are laid out in ABC.
+type Section struct {
+	Label    string   // Part label from a P: field in the body, if any
+	Notes    []Note   // Notes played every time through
+	Endings  [][]Note // Variant endings, the first played the first time through and so on
+	Repeated bool     // Whether the section is enclosed in repeat signs
+}
+
+// play returns the section's notes for its nth time through, counting from zero.
+func (s Section) play(n int) []Note {
+	notes := slices.Clone(s.Notes)
+
+	if len(s.Endings) > 0 {
+		notes = append(notes, s.Endings[min(n, len(s.Endings)-1)]...)
+	}
+
+	return notes
+}
+
+// Melody is the music of a tune's body split into sections.
+type Melody struct {
+	Pickup   []Note // Notes leading into the first section, played once
+	Sections []Section
+}
+
+// Expand returns the notes of the melody from start to finish. The parts are the part
+// names of the tune's structure in playing order (ex: A, A, B, B), and are followed
+// when every part named can be matched to sections of the melody, with the nth time a
+// part is played taking its nth ending. Otherwise the melody is played as written,
+// with each repeated section played once per ending and at least twice.
+func (m *Melody) Expand(parts []string) []Note {
+	notes := slices.Clone(m.Pickup)
+
+	byName := m.partSections(parts)
+	if byName == nil {
+		for _, section := range m.Sections {
+			times := 1
+			if section.Repeated {
+				times = max(2, len(section.Endings))
+			}
+
+			for n := range times {
+				notes = append(notes, section.play(n)...)
+			}
+		}
+
+		return notes
+	}
+
+	played := make(map[string]int)
+
+	for _, name := range parts {
+		for _, section := range byName[name] {
+			notes = append(notes, section.play(played[name])...)
+		}
+		played[name]++
+	}
+
+	return notes
+}
+
+// partSections matches part names to the sections of the melody, using the labels of
+// the P: fields in the body when there are any and otherwise taking the sections in
+// order as the parts in order of first appearance. A primed part (ex: A') is a variant
+// that falls back to its unprimed part when it has no sections of its own. It returns
+// nil if any part cannot be matched.
+func (m *Melody) partSections(parts []string) map[string][]Section {
+	if len(parts) == 0 || len(m.Sections) == 0 {
+		return nil
+	}
+
+	byName := make(map[string][]Section)
+
+	labelled := slices.ContainsFunc(m.Sections, func(s Section) bool { return s.Label != "" })
+
+	if labelled {
+		for _, section := range m.Sections {
+			if section.Label != "" {
+				byName[section.Label] = append(byName[section.Label], section)
+			}
+		}
+	} else {
+		var order []string
+		for _, name := range parts {
+			base := strings.TrimRight(name, "'")
+			if !slices.Contains(order, base) {
+				order = append(order, base)
+			}
+		}
+
+		if len(order) != len(m.Sections) {
+			return nil
+		}
+
+		for i, base := range order {
+			byName[base] = []Section{m.Sections[i]}
+		}
+	}
+
+	for _, name := range parts {
+		if byName[name] != nil {
+			continue
+		}
+
+		sections := byName[strings.TrimRight(name, "'")]
+		if sections == nil {
+			return nil
+		}
+
+		byName[name] = sections
+	}
+
+	return byName
+}
+
+// Semitones above C of each note letter in the scale
+var letterSemitones = map[byte]int{'C': 0, 'D': 2, 'E': 4, 'F': 5, 'G': 7, 'A': 9, 'B': 11}
+
+// Melody parses the notes of the tune's body in the given meter, with sharps the
+// number of sharps in the key signature (negative for flats). The unit note length is
+// taken from the L: field, defaulting as the standard says to a sixteenth for meters
+// under 3/4 and an eighth otherwise.
+//
+// Chord symbols, decorations, grace notes and slurs are skipped, and key or meter
+// changes within the body are not followed.
+func (t *Tune) Melody(beats, unit, sharps int) (*Melody, error) {
+	p := &melodyParser{
+		unit:      0.125,
+		barLength: float64(beats) / float64(unit),
+		compound:  beats%3 == 0 && beats > 3,
+		signature: keySignature(sharps),
+		section:   &Section{},
+		ending:    -1,
+	}
+
+	if float64(beats)/float64(unit) < 0.75 {
+		p.unit = 0.0625
+	}
+
+	if t.UnitLength != "" {
+		length, err := unitLength(t.UnitLength)
+		if err != nil {
+			return nil, err
+		}
+		p.unit = length
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(t.Body, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+
+		if isBodyField(line) {
+			err := p.field(line[0], strings.TrimSpace(line[2:]))
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if i := strings.IndexByte(line, '%'); i >= 0 {
+			line = line[:i]
+		}
+
+		err := p.line(line)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p.closeSection()
+
+	return &p.melody, nil
+}
+
+// unitLength parses an L: field such as "1/8".
+func unitLength(field string) (float64, error) {
+	num, den, found := strings.Cut(strings.TrimSpace(field), "/")
+	if !found {
+		den = "1"
+	}
+
+	n, err := strconv.Atoi(num)
+	if err != nil || n < 1 {
+		return 0, ErrInvalidUnitLength
+	}
+
+	d, err := strconv.Atoi(den)
+	if err != nil || d < 1 {
+		return 0, ErrInvalidUnitLength
+	}
+
+	return float64(n) / float64(d), nil
+}
+
+// keySignature returns the semitones the key signature raises or lowers each note
+// letter by.
+func keySignature(sharps int) map[byte]int {
+	signature := make(map[byte]int)
+
+	for i := 0; i < min(sharps, 7); i++ {
+		signature["FCGDAEB"[i]] = 1
+	}
+
+	for i := 0; i < min(-sharps, 7); i++ {
+		signature["BEADGCF"[i]] = -1
+	}
+
+	return signature
+}
+
+type melodyParser struct {
+	unit        float64        // Unit note length from the L: field
+	barLength   float64        // Length of a bar, for multi-bar rests
+	compound    bool           // Whether the meter is compound, which changes some tuplets
+	signature   map[byte]int   // Accidentals from the key signature by note letter
+	accidentals map[string]int // Accidentals written earlier in the bar by letter and octave
+
+	melody  Melody
+	section *Section // Section being read, added to the melody when it is closed
+	ending  int      // Index of the ending being read, or -1 for the section's main notes
+	bars    int      // Number of bar lines read in the section
+
+	tupletRatio float64 // Length multiplier for the notes of a tuplet
+	tupletNotes int     // Number of notes of the tuplet still to be read
+	broken      float64 // Length multiplier for the next note from a broken rhythm, or 0
+	tied        bool    // Whether the last note is tied to the next
+}
+
+// notes returns the notes being added to, either the section's or an ending's.
+func (p *melodyParser) notes() *[]Note {
+	if p.ending >= 0 {
+		return &p.section.Endings[p.ending]
+	}
+
+	return &p.section.Notes
+}
+
+func (p *melodyParser) field(name byte, value string) error {
+	switch name {
+	case 'L':
+		length, err := unitLength(value)
+		if err != nil {
+			return err
+		}
+		p.unit = length
+	case 'P':
+		p.closeSection()
+		p.section.Label = value
+	}
+
+	return nil
+}
+
+func (p *melodyParser) bar() {
+	p.bars++
+	p.accidentals = nil
+}
+
+// closeSection adds the section being read to the melody, if it has any music, and
+// starts a new one carrying the same part label.
+func (p *melodyParser) closeSection() {
+	if len(p.section.Notes) > 0 || len(p.section.Endings) > 0 {
+		p.melody.Sections = append(p.melody.Sections, *p.section)
+	}
+
+	p.section = &Section{Label: p.section.Label}
+	p.ending = -1
+	p.bars = 0
+	p.accidentals = nil
+}
+
+// startRepeat handles a |: sign. Notes before the first complete bar of the tune are
+// a pickup into the repeat rather than a section of their own.
+func (p *melodyParser) startRepeat() {
+	switch {
+	case p.bars > 0:
+		p.closeSection()
+	case len(p.melody.Sections) == 0 && p.ending < 0:
+		p.melody.Pickup = append(p.melody.Pickup, p.section.Notes...)
+		p.section.Notes = nil
+	}
+
+	p.section.Repeated = true
+}
+
+func (p *melodyParser) startEnding(n int) {
+	for len(p.section.Endings) < n {
+		p.section.Endings = append(p.section.Endings, nil)
+	}
+
+	p.ending = n - 1
+}
+
+// endRepeat handles a :| sign, whose section carries on if another ending follows.
+func (p *melodyParser) endRepeat(rest string) int {
+	p.section.Repeated = true
+	p.bar()
+
+	i := 0
+	for i < len(rest) && (rest[i] == '|' || rest[i] == ']' || rest[i] == ' ') {
+		i++
+	}
+
+	switch {
+	case i < len(rest) && rest[i] >= '1' && rest[i] <= '9':
+		p.startEnding(int(rest[i] - '0'))
+		return i + 1
+	case strings.HasPrefix(rest[i:], "[") && len(rest) > i+1 && rest[i+1] >= '1' && rest[i+1] <= '9':
+		p.startEnding(int(rest[i+1] - '0'))
+		return i + 2
+	case i < len(rest) && rest[i] == ':':
+		p.closeSection()
+		p.section.Repeated = true
+		return i + 1
+	}
+
+	p.closeSection()
+	return i
+}
+
+func (p *melodyParser) line(line string) error {
+	for i := 0; i < len(line); {
+		c := line[i]
+		rest := line[i:]
+
+		switch {
+		case c == '"' || c == '!' || c == '+':
+			end := strings.IndexByte(line[i+1:], c)
+			if end < 0 {
+				i++
+				continue
+			}
+			i += end + 2
+		case c == '{':
+			end := strings.IndexByte(rest, '}')
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			i += end + 1
+		case strings.HasPrefix(rest, "[|"):
+			p.bar()
+			p.closeSection()
+			i += 2
+		case len(rest) > 2 && c == '[' && isLetter(rest[1]) && rest[2] == ':':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				end = len(rest)
+			}
+
+			err := p.field(rest[1], strings.TrimSpace(rest[3:end]))
+			if err != nil {
+				return err
+			}
+			i += min(end+1, len(rest))
+		case len(rest) > 1 && c == '[' && rest[1] >= '1' && rest[1] <= '9':
+			p.startEnding(int(rest[1] - '0'))
+			i += 2
+		case c == '[':
+			i += p.chord(rest)
+		case strings.HasPrefix(rest, "::"):
+			p.section.Repeated = true
+			p.bar()
+			p.closeSection()
+			p.section.Repeated = true
+			i += 2
+		case strings.HasPrefix(rest, ":|"):
+			i += 2 + p.endRepeat(rest[2:])
+		case strings.HasPrefix(rest, "|:"):
+			p.startRepeat()
+			p.accidentals = nil
+			i += 2
+		case strings.HasPrefix(rest, "||"), strings.HasPrefix(rest, "|]"):
+			p.bar()
+			p.closeSection()
+			i += 2
+		case c == '|':
+			p.bar()
+			i++
+			if i < len(line) && line[i] >= '1' && line[i] <= '9' {
+				p.startEnding(int(line[i] - '0'))
+				i++
+			}
+		case c == '(' && len(rest) > 1 && rest[1] >= '2' && rest[1] <= '9':
+			p.tuplet(int(rest[1] - '0'))
+			i += 2
+		case c == '-':
+			p.tied = true
+			i++
+		case c == '>' || c == '<':
+			n := 1
+			for n < len(rest) && rest[n] == c {
+				n++
+			}
+			p.brokenRhythm(c, n)
+			i += n
+		case c == 'Z' || c == 'X':
+			bars, length := 1, 1
+			if n := digits(rest[1:]); n > 0 {
+				bars, _ = strconv.Atoi(rest[1 : 1+n])
+				length += n
+			}
+			p.add(nil, float64(bars)*p.barLength)
+			i += length
+		case c == 'z' || c == 'x':
+			length, n := p.length(rest[1:])
+			p.add(nil, length)
+			i += 1 + n
+		case strings.IndexByte("^_=ABCDEFGabcdefg", c) >= 0:
+			pitch, n := p.pitch(rest)
+			length, m := p.length(rest[n:])
+			p.add([]int{pitch}, length)
+			i += n + m
+		default:
+			i++
+		}
+	}
+
+	return nil
+}
+
+// chord reads a chord such as [CEG]2, whose length is that of its first note, and
+// returns the number of bytes read.
+func (p *melodyParser) chord(s string) int {
+	var pitches []int
+	length := 0.0
+
+	i := 1
+	for i < len(s) && s[i] != ']' {
+		if strings.IndexByte("^_=ABCDEFGabcdefg", s[i]) < 0 {
+			i++
+			continue
+		}
+
+		pitch, n := p.pitch(s[i:])
+		noteLength, m := p.length(s[i+n:])
+		if pitches == nil {
+			length = noteLength
+		}
+
+		pitches = append(pitches, pitch)
+		i += n + m
+	}
+
+	if i < len(s) {
+		i++
+	}
+
+	multiplier, n := p.length(s[i:])
+	if pitches != nil {
+		p.add(pitches, length*multiplier/p.unit)
+	}
+
+	return i + n
+}
+
+// pitch reads a note's accidentals, letter and octave marks, returning its MIDI note
+// number and the number of bytes read.
+func (p *melodyParser) pitch(s string) (int, int) {
+	i := 0
+	accidental, explicit := 0, false
+
+	for i < len(s) && strings.IndexByte("^_=", s[i]) >= 0 {
+		switch s[i] {
+		case '^':
+			accidental++
+		case '_':
+			accidental--
+		}
+		explicit = true
+		i++
+	}
+
+	if i >= len(s) || strings.IndexByte("ABCDEFGabcdefg", s[i]) < 0 {
+		return 60, max(i, 1)
+	}
+
+	letter := s[i]
+	upper := letter &^ 0x20
+	octave := 0
+	if letter >= 'a' {
+		octave = 1
+	}
+	i++
+
+	for i < len(s) && (s[i] == '\'' || s[i] == ',') {
+		if s[i] == '\'' {
+			octave++
+		} else {
+			octave--
+		}
+		i++
+	}
+
+	name := string(upper) + strconv.Itoa(octave)
+
+	// An accidental lasts until the end of the bar for the same note in the same octave
+	switch {
+	case explicit:
+		if p.accidentals == nil {
+			p.accidentals = make(map[string]int)
+		}
+		p.accidentals[name] = accidental
+	default:
+		var ok bool
+		if accidental, ok = p.accidentals[name]; !ok {
+			accidental = p.signature[upper]
+		}
+	}
+
+	return 60 + 12*octave + letterSemitones[upper] + accidental, i
+}
+
+// length reads a length multiplier such as 2, /2, 3/2 or //, returning the length it
+// gives a note as a fraction of a whole note and the number of bytes read.
+func (p *melodyParser) length(s string) (float64, int) {
+	num, den := 1, 1
+
+	i := digits(s)
+	if i > 0 {
+		num, _ = strconv.Atoi(s[:i])
+	}
+
+	for i < len(s) && s[i] == '/' {
+		i++
+
+		n := digits(s[i:])
+		if n == 0 {
+			den *= 2
+			continue
+		}
+
+		d, _ := strconv.Atoi(s[i : i+n])
+		den *= max(d, 1)
+		i += n
+	}
+
+	return p.unit * float64(num) / float64(den), i
+}
+
+func digits(s string) int {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return i
+}
+
+// tuplet starts a tuplet of n notes, played in the time the standard gives for it (ex:
+// three in the time of two for a triplet).
+func (p *melodyParser) tuplet(n int) {
+	in := 2
+	switch n {
+	case 2, 4, 8:
+		in = 3
+	case 3, 6:
+		in = 2
+	default:
+		if p.compound {
+			in = 3
+		}
+	}
+
+	p.tupletRatio = float64(in) / float64(n)
+	p.tupletNotes = n
+}
+
+// brokenRhythm lengthens the last note and shortens the next one for >, or the other
+// way round for <, with each extra sign halving the shorter note again.
+func (p *melodyParser) brokenRhythm(sign byte, n int) {
+	notes := *p.notes()
+	if len(notes) == 0 {
+		return
+	}
+
+	short := 1.0
+	for range n {
+		short /= 2
+	}
+
+	long := 2 - short
+
+	if sign == '<' {
+		long, short = short, long
+	}
+
+	notes[len(notes)-1].Length *= long
+	p.broken = short
+}
+
+func (p *melodyParser) add(pitches []int, length float64) {
+	if p.tupletNotes > 0 {
+		length *= p.tupletRatio
+		p.tupletNotes--
+	}
+
+	if p.broken != 0 {
+		length *= p.broken
+		p.broken = 0
+	}
+
+	notes := p.notes()
+
+	tied := p.tied
+	p.tied = false
+
+	if tied && pitches != nil && len(*notes) > 0 {
+		last := &(*notes)[len(*notes)-1]
+		if slices.Equal(last.Pitches, pitches) {
+			last.Length += length
+			return
+		}
+	}
+
+	*notes = append(*notes, Note{Pitches: pitches, Length: length})
+}
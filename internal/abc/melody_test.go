@@ -0,0 +1,70 @@
+package abc
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMelodyExpand(t *testing.T) {
+	aPart := []int{62, 64, 66, 67}
+	bPart := []int{73, 74, 76, 78, 79}
+
+	want := slices.Concat(
+		aPart, []int{69, 69},
+		aPart, []int{71, 71},
+		bPart, bPart,
+	)
+
+	wantLengths := []float64{
+		0.125, 0.125, 0.125, 0.125, 0.25, 0.25,
+		0.125, 0.125, 0.125, 0.125, 0.25, 0.25,
+		0.125, 0.125, 0.125, 0.125, 0.5,
+		0.125, 0.125, 0.125, 0.125, 0.5,
+	}
+
+	unlabelled := "|:DE FG|1 A2 A2:|2 B2 B2||\n|:cd ef|g4:|\n"
+	labelled := "P:A\n|:DE FG|1 A2 A2:|2 B2 B2||\nP:B\n|:cd ef|g4:|\n"
+
+	tests := []struct {
+		name  string
+		body  string
+		parts []string
+	}{
+		{"structure", unlabelled, []string{"A", "A", "B", "B"}},
+		{"part labels", labelled, []string{"A", "A", "B", "B"}},
+		{"as written", unlabelled, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// D major, so F and c are sharpened by the key signature
+			tune := &Tune{Body: tt.body}
+
+			melody, err := tune.Melody(4, 4, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			notes := melody.Expand(tt.parts)
+
+			var pitches []int
+			var lengths []float64
+
+			for _, note := range notes {
+				if len(note.Pitches) != 1 {
+					t.Fatalf("got note with pitches %v, want a single pitch", note.Pitches)
+				}
+				pitches = append(pitches, note.Pitches[0])
+				lengths = append(lengths, note.Length)
+			}
+
+			if !slices.Equal(pitches, want) {
+				t.Errorf("got pitches %v, want %v", pitches, want)
+			}
+
+			if !slices.Equal(lengths, wantLengths) {
+				t.Errorf("got lengths %v, want %v", lengths, wantLengths)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+var ErrDuplicateAlias = errors.New("duplicate alias")
+
+type TuneAlias struct {
+	ID        int64     `json:"id"`      // Unique integer ID for the alias
+	TuneID    int64     `json:"tune_id"` // ID of the tune the alias belongs to
+	CreatedAt time.Time `json:"-"`       // Timestamp for when the alias is added to our database
+	Title     string    `json:"title"`   // Alternate title the tune is known by
+}
+
+func ValidateTuneAlias(v *validator.Validator, alias *TuneAlias, tune *Tune) {
+	v.Check(alias.Title != "", "title", "must be provided")
+	v.Check(len(alias.Title) <= 500, "title", "must not be more than 500 bytes long")
+	v.Check(!strings.EqualFold(alias.Title, tune.Title), "title", "must be different from the tune's title")
+}
+
+type TuneAliasModel struct {
+	DB *sql.DB
+}
+
+func (m TuneAliasModel) Insert(alias *TuneAlias) error {
+	query := `
+		INSERT INTO tune_aliases (tune_id, title)
+		VALUES ($1, $2)
+		RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, alias.TuneID, alias.Title).Scan(&alias.ID, &alias.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "tune_aliases_tune_id_title_key"`:
+			return ErrDuplicateAlias
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m TuneAliasModel) GetAllForTune(tuneID int64) ([]*TuneAlias, error) {
+	query := `
+		SELECT id, tune_id, created_at, title
+		FROM tune_aliases
+		WHERE tune_id = $1
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, tuneID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aliases := []*TuneAlias{}
+
+	for rows.Next() {
+		var alias TuneAlias
+
+		err := rows.Scan(&alias.ID, &alias.TuneID, &alias.CreatedAt, &alias.Title)
+		if err != nil {
+			return nil, err
+		}
+
+		aliases = append(aliases, &alias)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return aliases, nil
+}
+
+// GetTuneIDsForTitle returns the IDs of the tunes that have an alias equal to the
+// title, ignoring case.
+func (m TuneAliasModel) GetTuneIDsForTitle(title string) ([]int64, error) {
+	query := `
+		SELECT DISTINCT tune_id
+		FROM tune_aliases
+		WHERE title = $1
+		ORDER BY tune_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, title)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+
+	for rows.Next() {
+		var id int64
+
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (m TuneAliasModel) Delete(tuneID, id int64) error {
+	if tuneID < 1 || id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM tune_aliases
+		WHERE id = $1 AND tune_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, tuneID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,236 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"jambuster.njvanhaute.com/internal/storage"
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+var AttachmentKinds = []string{"sheet_music", "tab", "chart"}
+
+// AttachmentMimeTypes are the file formats accepted for attachments, as sniffed from
+// their contents.
+var AttachmentMimeTypes = []string{"application/pdf", "image/png", "image/jpeg", "text/plain"}
+
+type Attachment struct {
+	ID         int64     `json:"id"`                   // Unique integer ID for the attachment
+	TuneID     int64     `json:"tune_id"`              // ID of the tune the attachment is for
+	CreatedAt  time.Time `json:"created_at"`           // Timestamp for when the attachment is uploaded
+	Kind       string    `json:"kind"`                 // What the file is (sheet_music, tab or chart)
+	Instrument *string   `json:"instrument,omitempty"` // Instrument the file is written for, always given for tabs
+	Filename   string    `json:"filename"`             // Name of the file as uploaded
+	MimeType   string    `json:"mime_type"`            // Format of the file (ex: application/pdf)
+	SizeBytes  int64     `json:"size_bytes"`           // Size of the file in bytes
+	Checksum   string    `json:"checksum"`             // Hex-encoded SHA-256 checksum of the file
+	StorageKey string    `json:"-"`                    // Key the file is stored under
+}
+
+func ValidateAttachment(v *validator.Validator, attachment *Attachment) {
+	v.Check(attachment.Kind != "", "kind", "must be provided")
+	v.Check(validator.PermittedValue(attachment.Kind, AttachmentKinds...), "kind", "must be one of "+strings.Join(AttachmentKinds, ", "))
+
+	if attachment.Instrument != nil {
+		v.Check(validator.PermittedValue(*attachment.Instrument, Instruments...), "instrument", "must be one of "+strings.Join(Instruments, ", "))
+	}
+
+	// A tab is only readable on the instrument it was written for
+	v.Check(attachment.Kind != "tab" || attachment.Instrument != nil, "instrument", "must be provided for a tab")
+
+	v.Check(attachment.Filename != "", "file", "must have a filename")
+	v.Check(len(attachment.Filename) <= 255, "file", "must have a filename not more than 255 bytes long")
+
+	v.Check(validator.PermittedValue(attachment.MimeType, AttachmentMimeTypes...), "file", "must be a PDF, PNG, JPEG or plain text file")
+}
+
+type AttachmentModel struct {
+	DB      *sql.DB
+	Storage storage.Storage
+}
+
+// The attachments of a tune, without their contents, selected as a JSON array
+// alongside the tune's own columns and decoded by scanAttachments
+const tuneAttachmentsColumn = `
+			(SELECT coalesce(json_agg(json_build_object('id', attachments.id, 'tune_id', attachments.tune_id,
+				'created_at', attachments.created_at, 'kind', attachments.kind, 'instrument', attachments.instrument,
+				'filename', attachments.filename, 'mime_type', attachments.mime_type, 'size_bytes', attachments.size_bytes,
+				'checksum', attachments.checksum)
+				ORDER BY attachments.id), '[]')
+			FROM attachments
+			WHERE attachments.tune_id = tunes.id)`
+
+func (tune *Tune) scanAttachments(attachments []byte) error {
+	return json.Unmarshal(attachments, &tune.Attachments)
+}
+
+// Insert stores the file read from body and adds the attachment, setting its size
+// and checksum from what was read. The file is removed again if the attachment cannot
+// be added, and ErrRecordNotFound is returned if the tune no longer exists.
+func (m AttachmentModel) Insert(attachment *Attachment, body io.Reader) error {
+	file, err := storeFile(m.Storage, fmt.Sprintf("attachments/%d", attachment.TuneID), body)
+	if err != nil {
+		return err
+	}
+
+	attachment.StorageKey = file.key
+	attachment.SizeBytes = file.size
+	attachment.Checksum = file.checksum
+
+	query := `
+		INSERT INTO attachments (tune_id, kind, instrument, filename, mime_type, size_bytes, checksum, storage_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at`
+
+	args := []any{attachment.TuneID, attachment.Kind, attachment.Instrument, attachment.Filename, attachment.MimeType,
+		attachment.SizeBytes, attachment.Checksum, attachment.StorageKey}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&attachment.ID, &attachment.CreatedAt)
+	if err != nil {
+		m.Storage.Delete(attachment.StorageKey)
+
+		switch {
+		case err.Error() == `pq: insert or update on table "attachments" violates foreign key constraint "attachments_tune_id_fkey"`:
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m AttachmentModel) Get(tuneID, id int64) (*Attachment, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, tune_id, created_at, kind, instrument, filename, mime_type, size_bytes, checksum, storage_key
+		FROM attachments
+		WHERE id = $1 AND tune_id = $2`
+
+	var attachment Attachment
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, tuneID).Scan(
+		&attachment.ID,
+		&attachment.TuneID,
+		&attachment.CreatedAt,
+		&attachment.Kind,
+		&attachment.Instrument,
+		&attachment.Filename,
+		&attachment.MimeType,
+		&attachment.SizeBytes,
+		&attachment.Checksum,
+		&attachment.StorageKey,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &attachment, nil
+}
+
+// GetAllForTune returns the tune's attachments, limited to the given kind and
+// instrument unless they are empty.
+func (m AttachmentModel) GetAllForTune(tuneID int64, kind, instrument string) ([]*Attachment, error) {
+	query := `
+		SELECT id, tune_id, created_at, kind, instrument, filename, mime_type, size_bytes, checksum, storage_key
+		FROM attachments
+		WHERE tune_id = $1
+		AND (kind = $2 OR $2 = '')
+		AND (instrument = $3 OR $3 = '')
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, tuneID, kind, instrument)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []*Attachment{}
+
+	for rows.Next() {
+		var attachment Attachment
+
+		err := rows.Scan(
+			&attachment.ID,
+			&attachment.TuneID,
+			&attachment.CreatedAt,
+			&attachment.Kind,
+			&attachment.Instrument,
+			&attachment.Filename,
+			&attachment.MimeType,
+			&attachment.SizeBytes,
+			&attachment.Checksum,
+			&attachment.StorageKey,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		attachments = append(attachments, &attachment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+// Open returns the attachment's file for reading.
+func (m AttachmentModel) Open(attachment *Attachment) (io.ReadSeekCloser, error) {
+	return m.Storage.Open(attachment.StorageKey)
+}
+
+// Delete removes the attachment and then its file. If the file cannot be removed the
+// error wraps ErrStorageCleanup.
+func (m AttachmentModel) Delete(tuneID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM attachments
+		WHERE id = $1 AND tune_id = $2
+		RETURNING storage_key`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var key string
+
+	err := m.DB.QueryRowContext(ctx, query, id, tuneID).Scan(&key)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return removeFiles(m.Storage, []string{key})
+}
@@ -0,0 +1,409 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+var (
+	ErrInvalidChordFormat  = errors.New("invalid chord format")
+	ErrDuplicateChordChart = errors.New("duplicate chord chart")
+)
+
+var chordQualities = []string{"", "m", "5", "6", "m6", "7", "m7", "maj7", "9", "m9", "maj9", "11", "13",
+	"dim", "dim7", "m7b5", "aug", "sus2", "sus4", "7sus4", "add9"}
+
+var (
+	sharpNames = []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+	flatNames  = []string{"C", "Db", "D", "Eb", "E", "F", "Gb", "G", "Ab", "A", "Bb", "B"}
+
+	// Nashville number for each number of semitones above the tonic
+	scaleDegrees = []string{"1", "b2", "2", "b3", "3", "4", "#4", "5", "b6", "6", "b7", "7"}
+)
+
+// Chord is a single chord symbol such as G, Em7 or D/F#. A chord without a root is
+// the "N.C." (no chord) marker.
+type Chord struct {
+	Root    string // Root note including any accidental (ex: F#)
+	Quality string // Chord quality suffix (ex: m7), empty for a major triad
+	Bass    string // Bass note of a slash chord, if any
+}
+
+func ParseChord(s string) (Chord, error) {
+	s = strings.TrimSpace(s)
+	if s == "N.C." {
+		return Chord{}, nil
+	}
+
+	symbol, bass, isSlash := strings.Cut(s, "/")
+
+	root, quality, ok := cutNote(symbol)
+	if !ok || !slices.Contains(chordQualities, quality) {
+		return Chord{}, ErrInvalidChordFormat
+	}
+
+	chord := Chord{Root: root, Quality: quality}
+
+	if isSlash {
+		note, rest, ok := cutNote(bass)
+		if !ok || rest != "" {
+			return Chord{}, ErrInvalidChordFormat
+		}
+		chord.Bass = note
+	}
+
+	return chord, nil
+}
+
+// cutNote splits a leading note name, such as "Bb" in "Bbm7", from the rest of s.
+func cutNote(s string) (note, rest string, ok bool) {
+	if s == "" || !strings.Contains("ABCDEFG", s[:1]) {
+		return "", "", false
+	}
+
+	if len(s) > 1 && (s[1] == '#' || s[1] == 'b') {
+		return s[:2], s[2:], true
+	}
+
+	return s[:1], s[1:], true
+}
+
+// pitchClass returns the note as a number of semitones above C, from 0 to 11.
+func pitchClass(note string) int {
+	semitones := []int{9, 11, 0, 2, 4, 5, 7}[note[0]-'A']
+
+	if len(note) > 1 {
+		switch note[1] {
+		case '#':
+			semitones++
+		case 'b':
+			semitones--
+		}
+	}
+
+	return (semitones + 12) % 12
+}
+
+func (c Chord) String() string {
+	if c.Root == "" {
+		return "N.C."
+	}
+
+	if c.Bass != "" {
+		return c.Root + c.Quality + "/" + c.Bass
+	}
+
+	return c.Root + c.Quality
+}
+
+// Transpose moves the chord by the given number of semitones, spelling the new notes
+// with flats when the target key signature has flats and with sharps otherwise.
+func (c Chord) Transpose(semitones int, to Key) Chord {
+	if c.Root == "" {
+		return c
+	}
+
+	names := sharpNames
+	if to.Signature() < 0 {
+		names = flatNames
+	}
+
+	move := func(note string) string {
+		return names[((pitchClass(note)+semitones)%12+12)%12]
+	}
+
+	transposed := Chord{Root: move(c.Root), Quality: c.Quality}
+	if c.Bass != "" {
+		transposed.Bass = move(c.Bass)
+	}
+
+	return transposed
+}
+
+// Nashville returns the chord as a Nashville number relative to the tonic of the key,
+// keeping its quality (ex: Em in G major is 6m, D7/F# is 57/7).
+func (c Chord) Nashville(key Key) string {
+	if c.Root == "" {
+		return "N.C."
+	}
+
+	degree := func(note string) string {
+		return scaleDegrees[(pitchClass(note)-key.PitchClass()+12)%12]
+	}
+
+	if c.Bass != "" {
+		return degree(c.Root) + c.Quality + "/" + degree(c.Bass)
+	}
+
+	return degree(c.Root) + c.Quality
+}
+
+func (c Chord) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(c.String())), nil
+}
+
+func (c *Chord) UnmarshalJSON(jsonValue []byte) error {
+	unquotedJSONValue, err := strconv.Unquote(string(jsonValue))
+	if err != nil {
+		return ErrInvalidChordFormat
+	}
+
+	chord, err := ParseChord(unquotedJSONValue)
+	if err != nil {
+		return err
+	}
+
+	*c = chord
+	return nil
+}
+
+type ChordPart struct {
+	Name string    `json:"name"` // Part name as written in the tune's structure (ex: A)
+	Bars [][]Chord `json:"bars"` // Chords in each bar of the part
+}
+
+type ChordChart struct {
+	TuneID    int64       `json:"tune_id"` // ID of the tune the chords belong to
+	CreatedAt time.Time   `json:"-"`       // Timestamp for when the chords are added to our database
+	Key       Key         `json:"key"`     // Key the chords are written in, one of the tune's keys
+	Parts     []ChordPart `json:"parts"`   // Progression for each distinct part of the tune
+	Version   int32       `json:"version"` // The version number starts at 1 and will be incremented each time the chords are updated
+}
+
+type NashvillePart struct {
+	Name string     `json:"name"`
+	Bars [][]string `json:"bars"`
+}
+
+// Transpose returns a copy of the chart with every chord moved into the given key.
+func (c *ChordChart) Transpose(to Key) *ChordChart {
+	semitones := Interval(c.Key, to)
+
+	transposed := *c
+	transposed.Key = to
+	transposed.Parts = make([]ChordPart, len(c.Parts))
+
+	for i, part := range c.Parts {
+		transposed.Parts[i] = ChordPart{Name: part.Name, Bars: make([][]Chord, len(part.Bars))}
+
+		for j, bar := range part.Bars {
+			for _, chord := range bar {
+				transposed.Parts[i].Bars[j] = append(transposed.Parts[i].Bars[j], chord.Transpose(semitones, to))
+			}
+		}
+	}
+
+	return &transposed
+}
+
+// Nashville returns the chart's progression as Nashville numbers relative to the key.
+func (c *ChordChart) Nashville(key Key) []NashvillePart {
+	parts := make([]NashvillePart, len(c.Parts))
+
+	for i, part := range c.Parts {
+		parts[i] = NashvillePart{Name: part.Name, Bars: make([][]string, len(part.Bars))}
+
+		for j, bar := range part.Bars {
+			for _, chord := range bar {
+				parts[i].Bars[j] = append(parts[i].Bars[j], chord.Nashville(key))
+			}
+		}
+	}
+
+	return parts
+}
+
+func ValidateChordChart(v *validator.Validator, chart *ChordChart, tune *Tune) {
+	v.Check(chart.Key != Key{}, "key", "must be provided")
+	v.Check(slices.Contains(tune.Keys, chart.Key), "key", "must be one of the tune's keys")
+
+	v.Check(chart.Parts != nil, "parts", "must be provided")
+	v.Check(len(chart.Parts) >= 1, "parts", "must contain at least 1 part")
+
+	names := make([]string, len(chart.Parts))
+	for i, part := range chart.Parts {
+		names[i] = part.Name
+	}
+	v.Check(validator.Unique(names), "parts", "must not contain the same part more than once")
+
+	if tune.ParsedStructure == nil {
+		v.AddError("parts", "cannot be checked because the tune's structure is not valid")
+		return
+	}
+
+	bars := make(map[string]int)
+	for _, part := range tune.ParsedStructure.Parts {
+		bars[part.Name] = part.Bars
+	}
+
+	for _, part := range chart.Parts {
+		key := "parts." + part.Name
+
+		expected, ok := bars[part.Name]
+		v.Check(ok, key, "must be a part in the tune's structure")
+		v.Check(len(part.Bars) >= 1, key, "must contain at least 1 bar")
+		v.Check(len(part.Bars) <= 999, key, "must not contain more than 999 bars")
+
+		if ok && expected != 0 {
+			v.Check(len(part.Bars) == expected, key, fmt.Sprintf("must contain %d bars to match the tune's structure", expected))
+		}
+
+		for _, bar := range part.Bars {
+			v.Check(len(bar) >= 1, key, "must contain at least 1 chord in every bar")
+			v.Check(len(bar) <= 4, key, "must not contain more than 4 chords in a bar")
+		}
+	}
+}
+
+type ChordChartModel struct {
+	DB *sql.DB
+}
+
+func (m ChordChartModel) Insert(chart *ChordChart) error {
+	query := `
+		INSERT INTO chord_charts (tune_id, key, parts)
+		VALUES ($1, $2, $3)
+		RETURNING created_at, version`
+
+	parts, err := json.Marshal(chart.Parts)
+	if err != nil {
+		return err
+	}
+
+	args := []any{chart.TuneID, chart.Key, parts}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&chart.CreatedAt, &chart.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "chord_charts_pkey"`:
+			return ErrDuplicateChordChart
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m ChordChartModel) Get(tuneID int64) (*ChordChart, error) {
+	if tuneID < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT tune_id, created_at, key, parts, version
+		FROM chord_charts
+		WHERE tune_id = $1`
+
+	var chart ChordChart
+	var key string
+	var parts []byte
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, tuneID).Scan(
+		&chart.TuneID,
+		&chart.CreatedAt,
+		&key,
+		&parts,
+		&chart.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	chart.Key, err = ParseKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(parts, &chart.Parts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &chart, nil
+}
+
+func (m ChordChartModel) Update(chart *ChordChart) error {
+	query := `
+		UPDATE chord_charts
+		SET key = $1, parts = $2, version = version + 1
+		WHERE tune_id = $3 AND version = $4
+		RETURNING version`
+
+	parts, err := json.Marshal(chart.Parts)
+	if err != nil {
+		return err
+	}
+
+	args := []any{
+		chart.Key,
+		parts,
+		chart.TuneID,
+		chart.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&chart.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m ChordChartModel) Delete(tuneID int64) error {
+	if tuneID < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM chord_charts
+		WHERE tune_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, tuneID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
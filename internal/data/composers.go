@@ -0,0 +1,250 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+var (
+	ErrDuplicateComposer = errors.New("duplicate composer")
+	ErrComposerInUse     = errors.New("composer in use")
+)
+
+type Composer struct {
+	ID        int64     `json:"id"`      // Unique integer ID for the composer
+	CreatedAt time.Time `json:"-"`       // Timestamp for when the composer is added to our database
+	Name      string    `json:"name"`    // Composer name (ex: Bill Monroe)
+	Version   int32     `json:"version"` // The version number starts at 1 and will be incremented each time the composer is updated
+}
+
+func ValidateComposer(v *validator.Validator, composer *Composer) {
+	v.Check(composer.Name != "", "name", "must be provided")
+	v.Check(len(composer.Name) <= 500, "name", "must not be more than 500 bytes long")
+}
+
+type ComposerModel struct {
+	DB *sql.DB
+}
+
+func (m ComposerModel) Insert(composer *Composer) error {
+	query := `
+		INSERT INTO composers (name)
+		VALUES ($1)
+		RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, composer.Name).Scan(&composer.ID, &composer.CreatedAt, &composer.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "composers_name_key"`:
+			return ErrDuplicateComposer
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m ComposerModel) Get(id int64) (*Composer, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, name, version
+		FROM composers
+		WHERE id = $1`
+
+	var composer Composer
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&composer.ID,
+		&composer.CreatedAt,
+		&composer.Name,
+		&composer.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &composer, nil
+}
+
+// GetByIDs returns the composers with the given IDs, ordered by name. IDs that do not
+// exist are skipped, so callers compare the lengths to detect them.
+func (m ComposerModel) GetByIDs(ids []int64) ([]Composer, error) {
+	query := `
+		SELECT id, created_at, name, version
+		FROM composers
+		WHERE id = ANY($1)
+		ORDER BY name, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	composers := []Composer{}
+
+	for rows.Next() {
+		var composer Composer
+
+		err := rows.Scan(&composer.ID, &composer.CreatedAt, &composer.Name, &composer.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		composers = append(composers, composer)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return composers, nil
+}
+
+func (m ComposerModel) GetAll(name string, filters Filters) ([]*Composer, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, name, version
+		FROM composers
+		WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		ORDER BY %s %s, id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	composers := []*Composer{}
+
+	for rows.Next() {
+		var composer Composer
+
+		err := rows.Scan(
+			&totalRecords,
+			&composer.ID,
+			&composer.CreatedAt,
+			&composer.Name,
+			&composer.Version,
+		)
+
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		composers = append(composers, &composer)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return composers, metadata, nil
+}
+
+func (m ComposerModel) Update(composer *Composer) error {
+	query := `
+		UPDATE composers
+		SET name = $1, version = version + 1
+		WHERE id = $2 AND version = $3
+		RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, composer.Name, composer.ID, composer.Version).Scan(&composer.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "composers_name_key"`:
+			return ErrDuplicateComposer
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m ComposerModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM composers
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: update or delete on table "composers" violates foreign key constraint "tune_composers_composer_id_fkey" on table "tune_composers"`:
+			return ErrComposerInUse
+		default:
+			return err
+		}
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// CountTunes returns the number of tunes crediting the composer.
+func (m ComposerModel) CountTunes(id int64) (int, error) {
+	query := `
+		SELECT count(*)
+		FROM tune_composers
+		WHERE composer_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&count)
+	return count, err
+}
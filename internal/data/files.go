@@ -0,0 +1,69 @@
+package data
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"jambuster.njvanhaute.com/internal/storage"
+)
+
+// ErrStorageCleanup is returned alongside the storage error when records were deleted
+// but one or more of their files could not be removed. The deletion itself succeeded.
+var ErrStorageCleanup = errors.New("stored files could not be removed")
+
+// storedFile describes a file written by storeFile.
+type storedFile struct {
+	key      string
+	size     int64
+	checksum string // Hex-encoded SHA-256 checksum of the contents
+}
+
+// storeFile writes body to a new key under dir.
+func storeFile(store storage.Storage, dir string, body io.Reader) (storedFile, error) {
+	key, err := storage.NewKey(dir)
+	if err != nil {
+		return storedFile{}, err
+	}
+
+	hash := sha256.New()
+	counter := &countingWriter{}
+
+	err = store.Put(key, io.TeeReader(body, io.MultiWriter(hash, counter)))
+	if err != nil {
+		return storedFile{}, err
+	}
+
+	return storedFile{key: key, size: counter.n, checksum: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// removeFiles deletes the stored files for records that have already been deleted,
+// trying every key and wrapping any failures in ErrStorageCleanup.
+func removeFiles(store storage.Storage, keys []string) error {
+	var errs []error
+
+	for _, key := range keys {
+		err := store.Delete(key)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+
+	if errs != nil {
+		return fmt.Errorf("%w: %w", ErrStorageCleanup, errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
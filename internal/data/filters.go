@@ -19,6 +19,10 @@ type Metadata struct {
 	FirstPage    int `json:"first_page,omitempty"`
 	LastPage     int `json:"last_page,omitempty"`
 	TotalRecords int `json:"total_records,omitempty"`
+
+	// Set when a title search matched no tune word for word, so that tunes with a
+	// similar title were returned instead
+	FuzzyTitleMatch bool `json:"fuzzy_title_match,omitempty"`
 }
 
 func ValidateFilters(v *validator.Validator, f Filters) {
@@ -0,0 +1,573 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+// JamUser is the public view of a user taking part in a jam.
+type JamUser struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type Jam struct {
+	ID        int64     `json:"id"`        // Unique integer ID for the jam
+	CreatedAt time.Time `json:"-"`         // Timestamp for when the jam is added to our database
+	Date      string    `json:"date"`      // Date of the jam (ex: 2024-05-14)
+	Location  string    `json:"location"`  // Where the jam was held
+	Host      *JamUser  `json:"host"`      // User who hosted the jam, null if the user has been deleted
+	Attendees []JamUser `json:"attendees"` // Users who came to the jam
+	Notes     string    `json:"notes"`     // Free-form notes about the jam
+	Version   int32     `json:"version"`   // The version number starts at 1 and will be incremented each time the jam is updated
+}
+
+type JamPlay struct {
+	ID       int64     `json:"id"`            // Unique integer ID for the play
+	JamID    int64     `json:"jam_id"`        // ID of the jam the tune was played at
+	TuneID   int64     `json:"tune_id"`       // ID of the tune that was played
+	Title    string    `json:"title"`         // Title of the tune, read from the tune itself
+	PlayedAt time.Time `json:"played_at"`     // When the tune was played
+	Key      *Key      `json:"key,omitempty"` // Key the tune was played in, if recorded
+	Notes    string    `json:"notes"`         // Notes about this time through the tune
+}
+
+// TunePlayStats summarizes how often and how recently a tune has been played at jams.
+type TunePlayStats struct {
+	TuneID     int64   `json:"tune_id"`
+	Title      string  `json:"title"`
+	Plays      int     `json:"plays"`       // Number of times the tune was played
+	LastPlayed *string `json:"last_played"` // Date of the last jam the tune was played at, null if never
+}
+
+func ValidateDate(v *validator.Validator, key, date string) {
+	v.Check(date != "", key, "must be provided")
+
+	_, err := time.Parse(time.DateOnly, date)
+	v.Check(err == nil, key, "must be a date in the format YYYY-MM-DD")
+}
+
+func ValidateJam(v *validator.Validator, jam *Jam) {
+	ValidateDate(v, "date", jam.Date)
+
+	v.Check(jam.Location != "", "location", "must be provided")
+	v.Check(len(jam.Location) <= 500, "location", "must not be more than 500 bytes long")
+	v.Check(len(jam.Notes) <= 5000, "notes", "must not be more than 5000 bytes long")
+
+	v.Check(jam.Attendees != nil, "attendees", "must be provided")
+	v.Check(len(jam.Attendees) <= 200, "attendees", "must not contain more than 200 users")
+}
+
+func ValidateJamPlay(v *validator.Validator, play *JamPlay) {
+	v.Check(play.TuneID > 0, "tune_id", "must be provided")
+	v.Check(len(play.Notes) <= 1000, "notes", "must not be more than 1000 bytes long")
+}
+
+type JamModel struct {
+	DB *sql.DB
+}
+
+// GetUsers returns the users with the given IDs, ordered by name. IDs that do not exist
+// are skipped, so callers compare the lengths to detect them.
+func (m JamModel) GetUsers(ids []int64) ([]JamUser, error) {
+	query := `
+		SELECT id, name
+		FROM users
+		WHERE id = ANY($1)
+		ORDER BY name, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []JamUser{}
+
+	for rows.Next() {
+		var user JamUser
+
+		if err := rows.Scan(&user.ID, &user.Name); err != nil {
+			return nil, err
+		}
+
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// writeAttendees replaces the jam's attendees with the ones in jam.Attendees.
+func (j *Jam) writeAttendees(ctx context.Context, tx *sql.Tx) error {
+	userIDs := []int64{}
+	for _, user := range j.Attendees {
+		userIDs = append(userIDs, user.ID)
+	}
+
+	_, err := tx.ExecContext(ctx, `DELETE FROM jam_attendees WHERE jam_id = $1`, j.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO jam_attendees (jam_id, user_id) SELECT $1, unnest($2::bigint[])`, j.ID, pq.Array(userIDs))
+	return err
+}
+
+// getAttendees returns the attendees of each of the given jams, ordered by name.
+func (m JamModel) getAttendees(ctx context.Context, jamIDs []int64) (map[int64][]JamUser, error) {
+	query := `
+		SELECT jam_attendees.jam_id, users.id, users.name
+		FROM jam_attendees
+		INNER JOIN users ON users.id = jam_attendees.user_id
+		WHERE jam_attendees.jam_id = ANY($1)
+		ORDER BY users.name, users.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(jamIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attendees := make(map[int64][]JamUser)
+
+	for rows.Next() {
+		var jamID int64
+		var user JamUser
+
+		if err := rows.Scan(&jamID, &user.ID, &user.Name); err != nil {
+			return nil, err
+		}
+
+		attendees[jamID] = append(attendees[jamID], user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attendees, nil
+}
+
+func (j *Jam) hostID() *int64 {
+	if j.Host == nil {
+		return nil
+	}
+
+	return &j.Host.ID
+}
+
+func (m JamModel) Insert(jam *Jam) error {
+	query := `
+		INSERT INTO jams (date, location, host_id, notes)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, version`
+
+	args := []any{jam.Date, jam.Location, jam.hostID(), jam.Notes}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&jam.ID, &jam.CreatedAt, &jam.Version)
+	if err != nil {
+		return err
+	}
+
+	err = jam.writeAttendees(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// scanJam reads a row selected with the jamColumns into jam.
+func scanJam(scan func(dest ...any) error, jam *Jam, extra ...any) error {
+	var hostID sql.NullInt64
+	var hostName sql.NullString
+
+	dest := append(extra, &jam.ID, &jam.CreatedAt, &jam.Date, &jam.Location, &hostID, &hostName, &jam.Notes, &jam.Version)
+
+	err := scan(dest...)
+	if err != nil {
+		return err
+	}
+
+	if hostID.Valid {
+		jam.Host = &JamUser{ID: hostID.Int64, Name: hostName.String}
+	}
+
+	return nil
+}
+
+// The columns read by scanJam, with the host joined in from the users table
+const jamColumns = `jams.id, jams.created_at, to_char(jams.date, 'YYYY-MM-DD') AS date, jams.location,
+			users.id AS host_id, users.name AS host_name, jams.notes, jams.version`
+
+func (m JamModel) Get(id int64) (*Jam, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + jamColumns + `
+		FROM jams
+		LEFT JOIN users ON users.id = jams.host_id
+		WHERE jams.id = $1`
+
+	var jam Jam
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := scanJam(m.DB.QueryRowContext(ctx, query, id).Scan, &jam)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	attendees, err := m.getAttendees(ctx, []int64{jam.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	jam.Attendees = attendees[jam.ID]
+	if jam.Attendees == nil {
+		jam.Attendees = []JamUser{}
+	}
+
+	return &jam, nil
+}
+
+// GetAll returns the jams held between the two dates, either of which may be nil to
+// leave that end of the range open.
+func (m JamModel) GetAll(from, to *time.Time, location string, filters Filters) ([]*Jam, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), %s
+		FROM jams
+		LEFT JOIN users ON users.id = jams.host_id
+		WHERE (jams.date >= $1 OR $1 IS NULL)
+		AND (jams.date <= $2 OR $2 IS NULL)
+		AND (to_tsvector('simple', jams.location) @@ plainto_tsquery('simple', $3) OR $3 = '')
+		ORDER BY %s %s, jams.id ASC
+		LIMIT $4 OFFSET $5`, jamColumns, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, from, to, location, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	jams := []*Jam{}
+	jamIDs := []int64{}
+
+	for rows.Next() {
+		var jam Jam
+
+		err := scanJam(rows.Scan, &jam, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		jams = append(jams, &jam)
+		jamIDs = append(jamIDs, jam.ID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	attendees, err := m.getAttendees(ctx, jamIDs)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	for _, jam := range jams {
+		jam.Attendees = attendees[jam.ID]
+		if jam.Attendees == nil {
+			jam.Attendees = []JamUser{}
+		}
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return jams, metadata, nil
+}
+
+func (m JamModel) Update(jam *Jam) error {
+	query := `
+		UPDATE jams
+		SET date = $1, location = $2, host_id = $3, notes = $4, version = version + 1
+		WHERE id = $5 AND version = $6
+		RETURNING version`
+
+	args := []any{
+		jam.Date,
+		jam.Location,
+		jam.hostID(),
+		jam.Notes,
+		jam.ID,
+		jam.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&jam.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	err = jam.writeAttendees(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m JamModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM jams
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+type JamPlayModel struct {
+	DB *sql.DB
+}
+
+// Insert logs a play, stamping it with the current time unless PlayedAt is already set.
+func (m JamPlayModel) Insert(play *JamPlay) error {
+	query := `
+		INSERT INTO jam_plays (jam_id, tune_id, played_at, key, notes)
+		VALUES ($1, $2, coalesce($3, NOW()), $4, $5)
+		RETURNING id, played_at`
+
+	var playedAt *time.Time
+	if !play.PlayedAt.IsZero() {
+		playedAt = &play.PlayedAt
+	}
+
+	args := []any{play.JamID, play.TuneID, playedAt, play.Key, play.Notes}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&play.ID, &play.PlayedAt)
+}
+
+// GetAllForJam returns the tunes played at the jam in the order they were played.
+func (m JamPlayModel) GetAllForJam(jamID int64) ([]*JamPlay, error) {
+	query := `
+		SELECT jam_plays.id, jam_plays.jam_id, jam_plays.tune_id, tunes.title, jam_plays.played_at, jam_plays.key, jam_plays.notes
+		FROM jam_plays
+		INNER JOIN tunes ON tunes.id = jam_plays.tune_id
+		WHERE jam_plays.jam_id = $1
+		ORDER BY jam_plays.played_at, jam_plays.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, jamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plays := []*JamPlay{}
+
+	for rows.Next() {
+		var play JamPlay
+		var key sql.NullString
+
+		err := rows.Scan(&play.ID, &play.JamID, &play.TuneID, &play.Title, &play.PlayedAt, &key, &play.Notes)
+		if err != nil {
+			return nil, err
+		}
+
+		if key.Valid {
+			k, err := ParseKey(key.String)
+			if err != nil {
+				return nil, err
+			}
+			play.Key = &k
+		}
+
+		plays = append(plays, &play)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return plays, nil
+}
+
+func (m JamPlayModel) Delete(jamID, id int64) error {
+	if jamID < 1 || id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM jam_plays
+		WHERE id = $1 AND jam_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, jamID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m JamPlayModel) getStats(query string, args []any, filters Filters) ([]*TunePlayStats, Metadata, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	stats := []*TunePlayStats{}
+
+	for rows.Next() {
+		var s TunePlayStats
+
+		err := rows.Scan(&totalRecords, &s.TuneID, &s.Title, &s.Plays, &s.LastPlayed)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		stats = append(stats, &s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return stats, metadata, nil
+}
+
+// MostPlayed counts the plays of each tune at jams held between the two dates, either
+// of which may be nil to leave that end of the range open. Tunes that were not played
+// are left out.
+func (m JamPlayModel) MostPlayed(from, to *time.Time, filters Filters) ([]*TunePlayStats, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), tunes.id, tunes.title, count(*) AS plays,
+			to_char(max(jams.date), 'YYYY-MM-DD') AS last_played
+		FROM jam_plays
+		INNER JOIN jams ON jams.id = jam_plays.jam_id
+		INNER JOIN tunes ON tunes.id = jam_plays.tune_id
+		WHERE (jams.date >= $1 OR $1 IS NULL)
+		AND (jams.date <= $2 OR $2 IS NULL)
+		GROUP BY tunes.id
+		ORDER BY %s %s, tunes.id ASC
+		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	return m.getStats(query, []any{from, to, filters.limit(), filters.offset()}, filters)
+}
+
+// NotPlayedSince returns the tunes that have not been played at a jam in the given
+// number of weeks, including the ones that have never been played.
+func (m JamPlayModel) NotPlayedSince(weeks int, filters Filters) ([]*TunePlayStats, Metadata, error) {
+	// Tunes that have never been played sort as the least recently played
+	nulls := ""
+	if filters.sortColumn() == "last_played" {
+		nulls = " NULLS FIRST"
+		if filters.sortDirection() == "DESC" {
+			nulls = " NULLS LAST"
+		}
+	}
+
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), tunes.id, tunes.title, count(jam_plays.id) AS plays,
+			to_char(max(jams.date), 'YYYY-MM-DD') AS last_played
+		FROM tunes
+		LEFT JOIN jam_plays ON jam_plays.tune_id = tunes.id
+		LEFT JOIN jams ON jams.id = jam_plays.jam_id
+		GROUP BY tunes.id
+		HAVING max(jams.date) IS NULL OR max(jams.date) < CURRENT_DATE - $1::integer * 7
+		ORDER BY %s %s%s, tunes.id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection(), nulls)
+
+	return m.getStats(query, []any{weeks, filters.limit(), filters.offset()}, filters)
+}
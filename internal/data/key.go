@@ -1,52 +1,317 @@
 package data
 
 import (
+	"database/sql/driver"
 	"errors"
+	"fmt"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 )
 
-var ErrInvalidKeyFormat = errors.New("invalid key format")
+var (
+	ErrInvalidKeyFormat          = errors.New("invalid key format")
+	ErrInvalidKeySignatureFormat = errors.New("invalid key signature format")
+)
 
-type Key string
+var keyRX = regexp.MustCompile(`^([A-Ga-g])([#b]?)\s*([A-Za-z]*)$`)
 
-func (k *Key) UnmarshalJSON(jsonValue []byte) error {
-	unquotedJSONValue, err := strconv.Unquote(string(jsonValue))
-	if err != nil {
-		return ErrInvalidKeyFormat
+var KeyModes = []string{"major", "minor", "dorian", "phrygian", "lydian", "mixolydian", "locrian"}
+
+// Every mode name that shorthand may abbreviate, including the ionian and aeolian
+// synonyms for major and minor
+var modeNames = slices.Concat(KeyModes, []string{"ionian", "aeolian"})
+
+// Position of each mode's tonic on the circle of fifths relative to the tonic of the
+// major key sharing its signature (ex: A dorian shares G major's signature, so -2).
+var modeFifths = map[string]int{
+	"lydian":     1,
+	"major":      0,
+	"mixolydian": -1,
+	"dorian":     -2,
+	"minor":      -3,
+	"phrygian":   -4,
+	"locrian":    -5,
+}
+
+type Key struct {
+	Tonic      string // Note letter of the tonic (ex: F)
+	Accidental string // Accidental applied to the tonic, either "", "#" or "b"
+	Mode       string // One of major, minor, dorian, phrygian, lydian, mixolydian or locrian
+}
+
+// ParseKey accepts a key written as "<tonic> <mode>" as well as common shorthand such
+// as "Gm", "Amix", "D dor" or "F# min", and returns it in its canonical spelling so that
+// enharmonic keys are stored alike (ex: "Gb" is read as F# major).
+func ParseKey(s string) (Key, error) {
+	matches := keyRX.FindStringSubmatch(strings.TrimSpace(s))
+	if matches == nil {
+		return Key{}, ErrInvalidKeyFormat
 	}
 
-	parts := strings.Split(unquotedJSONValue, " ")
+	mode, ok := parseMode(matches[3])
+	if !ok {
+		return Key{}, ErrInvalidKeyFormat
+	}
 
-	if len(parts) != 2 || len(parts[0]) > 2 {
-		return ErrInvalidKeyFormat
+	key := Key{Tonic: strings.ToUpper(matches[1]), Accidental: matches[2], Mode: mode}
+
+	return key.Canonical(), nil
+}
+
+func parseMode(s string) (string, bool) {
+	s = strings.ToLower(s)
+
+	switch {
+	case s == "":
+		return "major", true
+	case s == "m":
+		return "minor", true
+	case len(s) < 3:
+		return "", false
 	}
 
-	tonic, mode := parts[0], parts[1]
+	for _, mode := range modeNames {
+		if strings.HasPrefix(mode, s) {
+			switch mode {
+			case "ionian":
+				return "major", true
+			case "aeolian":
+				return "minor", true
+			}
+			return mode, true
+		}
+	}
 
-	if !strings.ContainsAny(string(tonic[0]), "ABCDEFG") {
-		return ErrInvalidKeyFormat
+	return "", false
+}
+
+func (k Key) String() string {
+	return fmt.Sprintf("%s%s %s", k.Tonic, k.Accidental, k.Mode)
+}
+
+// KeySignature is the number of accidentals in a key signature, positive for sharps
+// and negative for flats. It is written as "1#", "2b" or "0".
+type KeySignature int
+
+func (ks KeySignature) String() string {
+	switch {
+	case ks > 0:
+		return fmt.Sprintf("%d#", ks)
+	case ks < 0:
+		return fmt.Sprintf("%db", -ks)
 	}
 
-	if len(tonic) == 2 && !strings.ContainsAny(string(tonic[1]), "b#") {
-		return ErrInvalidKeyFormat
+	return "0"
+}
+
+// ParseKeySignature accepts a key signature written as "0", "1#" or "2b".
+func ParseKeySignature(s string) (KeySignature, error) {
+	s = strings.TrimSpace(s)
+	if s == "0" {
+		return 0, nil
 	}
 
-	validModes := map[string]bool{
-		"major":      true,
-		"minor":      true,
-		"dorian":     true,
-		"phrygian":   true,
-		"lydian":     true,
-		"mixolydian": true,
-		"locrian":    true,
+	if len(s) != 2 || s[0] < '1' || s[0] > '7' {
+		return 0, ErrInvalidKeySignatureFormat
 	}
 
-	if !validModes[mode] {
+	count := KeySignature(s[0] - '0')
+
+	switch s[1] {
+	case '#':
+		return count, nil
+	case 'b':
+		return -count, nil
+	}
+
+	return 0, ErrInvalidKeySignatureFormat
+}
+
+func (ks KeySignature) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(ks.String())), nil
+}
+
+// Signature returns the key signature of the key (ex: 1# for E minor, 2b for G dorian).
+func (k Key) Signature() KeySignature {
+	return KeySignature(k.tonicFifths() + modeFifths[k.Mode])
+}
+
+// PitchClass returns the tonic as a number of semitones above C, from 0 to 11.
+func (k Key) PitchClass() int {
+	return (k.tonicFifths()*7%12 + 12) % 12
+}
+
+// Transpose returns the key moved by the given number of semitones with its mode
+// preserved, spelled with the fewest accidentals (ex: A# major is written Bb major).
+func (k Key) Transpose(semitones int) Key {
+	pitchClass := ((k.PitchClass()+semitones)%12 + 12) % 12
+
+	// 7 is its own inverse modulo 12, so this maps a pitch class back onto the circle of fifths
+	fifths := pitchClass * 7 % 12
+
+	return keyFromSignature(fifths+modeFifths[k.Mode], k.Mode).Canonical()
+}
+
+// Interval returns the shortest number of semitones from one tonic to another, between
+// -5 and 6 (ex: 2 from G to A, -2 from G to F).
+func Interval(from, to Key) int {
+	semitones := ((to.PitchClass()-from.PitchClass())%12 + 12) % 12
+	if semitones > 6 {
+		semitones -= 12
+	}
+
+	return semitones
+}
+
+// FifthsApart returns how many steps apart the tonics of two keys are on the circle of
+// fifths, from 0 for the same tonic to 6 for a tritone (ex: 1 from G to D, 5 from G to Ab).
+func FifthsApart(a, b Key) int {
+	fifths := ((b.PitchClass()-a.PitchClass())*7%12 + 12) % 12
+	return min(fifths, 12-fifths)
+}
+
+// RelativeMajor returns the major key sharing this key's signature.
+func (k Key) RelativeMajor() Key {
+	return keyFromSignature(int(k.Signature()), "major")
+}
+
+// RelativeMinor returns the minor key sharing this key's signature.
+func (k Key) RelativeMinor() Key {
+	return keyFromSignature(int(k.Signature()), "minor")
+}
+
+// Canonical returns the enharmonic spelling of the key with the fewest accidentals in
+// its signature. When both spellings need six, the one with a natural tonic is
+// preferred and otherwise sharps (ex: "A# major" becomes "Bb major", "Gb minor" becomes
+// "F# minor" and "F locrian" is kept rather than becoming "E# locrian").
+func (k Key) Canonical() Key {
+	signature := int(k.Signature())
+
+	switch {
+	case signature > 6:
+		signature -= 12
+	case signature < -6:
+		signature += 12
+	}
+
+	if signature == -6 && keyFromSignature(signature, k.Mode).Accidental != "" {
+		signature = 6
+	}
+
+	return keyFromSignature(signature, k.Mode)
+}
+
+// Enharmonics returns every spelling of the key that sounds the same, including the
+// key itself (ex: F# minor and Gb minor).
+func (k Key) Enharmonics() []Key {
+	var keys []Key
+
+	for _, offset := range []int{-12, 0, 12} {
+		if fifths := k.tonicFifths() + offset; fifths >= -8 && fifths <= 12 {
+			keys = append(keys, spellKey(fifths, k.Mode))
+		}
+	}
+
+	return keys
+}
+
+// KeysWithSignature returns the key in every mode that is written with the given key
+// signature (ex: G major, E minor, A dorian, D mixolydian... for 1#). When enharmonic
+// is true the keys whose signatures sound the same are included as well, so 6# also
+// returns the keys written with 6b.
+func KeysWithSignature(signature KeySignature, enharmonic bool) []Key {
+	signatures := []int{int(signature)}
+	if enharmonic {
+		signatures = append(signatures, int(signature)-12, int(signature)+12)
+	}
+
+	var keys []Key
+
+	for _, s := range signatures {
+		for _, mode := range KeyModes {
+			if fifths := s - modeFifths[mode]; fifths >= -8 && fifths <= 12 {
+				keys = append(keys, spellKey(fifths, mode))
+			}
+		}
+	}
+
+	return keys
+}
+
+// EnharmonicTo reports whether both keys sound the same (ex: F# minor and Gb minor).
+func (k Key) EnharmonicTo(other Key) bool {
+	return k.Canonical() == other.Canonical()
+}
+
+// tonicFifths returns the tonic's position on the circle of fifths counted from C,
+// so that G is 1, F is -1 and Bb is -2.
+func (k Key) tonicFifths() int {
+	fifths := strings.Index("FCGDAEB", k.Tonic) - 1
+
+	switch k.Accidental {
+	case "#":
+		fifths += 7
+	case "b":
+		fifths -= 7
+	}
+
+	return fifths
+}
+
+func keyFromSignature(signature int, mode string) Key {
+	fifths := signature - modeFifths[mode]
+
+	// Tonics that would need a double sharp or double flat are respelled enharmonically
+	for fifths > 12 {
+		fifths -= 12
+	}
+	for fifths < -8 {
+		fifths += 12
+	}
+
+	return spellKey(fifths, mode)
+}
+
+// spellKey builds the key whose tonic sits at the given position on the circle of
+// fifths, which must be between -8 (Fb) and 12 (B#).
+func spellKey(fifths int, mode string) Key {
+	// Shift into 0..20 so that each group of seven is one accidental: flats, naturals, sharps
+	index := fifths + 8
+	tonic := string("FCGDAEB"[index%7])
+
+	accidental := ""
+	switch {
+	case index < 7:
+		accidental = "b"
+	case index >= 14:
+		accidental = "#"
+	}
+
+	return Key{Tonic: tonic, Accidental: accidental, Mode: mode}
+}
+
+func (k Key) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(k.String())), nil
+}
+
+func (k *Key) UnmarshalJSON(jsonValue []byte) error {
+	unquotedJSONValue, err := strconv.Unquote(string(jsonValue))
+	if err != nil {
 		return ErrInvalidKeyFormat
 	}
 
-	*k = Key(unquotedJSONValue)
+	key, err := ParseKey(unquotedJSONValue)
+	if err != nil {
+		return err
+	}
+
+	*k = key
 
 	return nil
 }
+
+func (k Key) Value() (driver.Value, error) {
+	return k.String(), nil
+}
@@ -0,0 +1,225 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+var ErrDuplicateLyrics = errors.New("duplicate lyrics")
+
+var LyricSectionKinds = []string{"verse", "chorus", "refrain", "bridge", "tag"}
+
+// Chord annotations are written inline before the syllable they fall on, as in
+// "[G]Sail away ladies, [D]sail away"
+var chordAnnotationRX = regexp.MustCompile(`\[([^\]]*)\]`)
+
+type LyricSection struct {
+	Kind  string   `json:"kind"`            // One of verse, chorus, refrain, bridge or tag
+	Label string   `json:"label,omitempty"` // Optional label for the section (ex: Verse 2)
+	Lines []string `json:"lines"`           // Lines of the section, optionally annotated with chords
+}
+
+type Lyrics struct {
+	TuneID    int64          `json:"tune_id"`  // ID of the tune the lyrics belong to
+	CreatedAt time.Time      `json:"-"`        // Timestamp for when the lyrics are added to our database
+	Sections  []LyricSection `json:"sections"` // Sections in the order they are sung
+	Version   int32          `json:"version"`  // The version number starts at 1 and will be incremented each time the lyrics are updated
+}
+
+// PlainText returns every line of the lyrics with the chord annotations removed, one
+// line per row. This is the text that lyric searches run against.
+func (l *Lyrics) PlainText() string {
+	var lines []string
+
+	for _, section := range l.Sections {
+		for _, line := range section.Lines {
+			line = chordAnnotationRX.ReplaceAllString(line, "")
+			lines = append(lines, strings.Join(strings.Fields(line), " "))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func ValidateLyrics(v *validator.Validator, lyrics *Lyrics) {
+	v.Check(lyrics.Sections != nil, "sections", "must be provided")
+	v.Check(len(lyrics.Sections) >= 1, "sections", "must contain at least 1 section")
+	v.Check(len(lyrics.Sections) <= 50, "sections", "must not contain more than 50 sections")
+
+	for _, section := range lyrics.Sections {
+		v.Check(validator.PermittedValue(section.Kind, LyricSectionKinds...), "sections", "must have a kind of "+strings.Join(LyricSectionKinds, ", "))
+		v.Check(len(section.Label) <= 100, "sections", "must not have a label more than 100 bytes long")
+		v.Check(len(section.Lines) >= 1, "sections", "must contain at least 1 line in every section")
+
+		for _, line := range section.Lines {
+			v.Check(len(line) <= 500, "sections", "must not contain a line more than 500 bytes long")
+
+			for _, match := range chordAnnotationRX.FindAllStringSubmatch(line, -1) {
+				_, err := ParseChord(match[1])
+				v.Check(err == nil, "sections", "must only contain valid chord annotations (ex: [G], [D7/F#])")
+			}
+		}
+	}
+
+	v.Check(len(lyrics.PlainText()) <= 50_000, "sections", "must not contain more than 50000 bytes of text")
+}
+
+type LyricsModel struct {
+	DB *sql.DB
+}
+
+// insert adds the lyrics within a transaction, which may be the one adding their tune.
+func (lyrics *Lyrics) insert(ctx context.Context, tx *sql.Tx) error {
+	query := `
+		INSERT INTO lyrics (tune_id, sections, text)
+		VALUES ($1, $2, $3)
+		RETURNING created_at, version`
+
+	sections, err := json.Marshal(lyrics.Sections)
+	if err != nil {
+		return err
+	}
+
+	args := []any{lyrics.TuneID, sections, lyrics.PlainText()}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&lyrics.CreatedAt, &lyrics.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "lyrics_pkey"`:
+			return ErrDuplicateLyrics
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m LyricsModel) Insert(lyrics *Lyrics) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lyrics.insert(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m LyricsModel) Get(tuneID int64) (*Lyrics, error) {
+	if tuneID < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT tune_id, created_at, sections, version
+		FROM lyrics
+		WHERE tune_id = $1`
+
+	var lyrics Lyrics
+	var sections []byte
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, tuneID).Scan(
+		&lyrics.TuneID,
+		&lyrics.CreatedAt,
+		&sections,
+		&lyrics.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = json.Unmarshal(sections, &lyrics.Sections)
+	if err != nil {
+		return nil, err
+	}
+
+	return &lyrics, nil
+}
+
+func (m LyricsModel) Update(lyrics *Lyrics) error {
+	query := `
+		UPDATE lyrics
+		SET sections = $1, text = $2, version = version + 1
+		WHERE tune_id = $3 AND version = $4
+		RETURNING version`
+
+	sections, err := json.Marshal(lyrics.Sections)
+	if err != nil {
+		return err
+	}
+
+	args := []any{
+		sections,
+		lyrics.PlainText(),
+		lyrics.TuneID,
+		lyrics.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&lyrics.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m LyricsModel) Delete(tuneID int64) error {
+	if tuneID < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM lyrics
+		WHERE tune_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, tuneID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -3,6 +3,8 @@ package data
 import (
 	"database/sql"
 	"errors"
+
+	"jambuster.njvanhaute.com/internal/storage"
 )
 
 var (
@@ -11,17 +13,47 @@ var (
 )
 
 type Models struct {
+	Attachments AttachmentModel
+	ChordCharts ChordChartModel
+	Composers   ComposerModel
+	JamPlays    JamPlayModel
+	Jams        JamModel
+	Lyrics      LyricsModel
 	Permissions PermissionModel
+	Practice    PracticeModel
+	Recordings  RecordingModel
+	Repertoire  RepertoireModel
+	Setlists    SetlistModel
+	Sets        SetModel
+	Sources     SourceModel
+	Styles      StyleModel
 	Tokens      TokenModel
+	TuneAliases TuneAliasModel
 	Tunes       TuneModel
+	Tunings     TuningModel
 	Users       UserModel
 }
 
-func NewModels(db *sql.DB) Models {
+func NewModels(db *sql.DB, store storage.Storage) Models {
 	return Models{
+		Attachments: AttachmentModel{DB: db, Storage: store},
+		ChordCharts: ChordChartModel{DB: db},
+		Composers:   ComposerModel{DB: db},
+		JamPlays:    JamPlayModel{DB: db},
+		Jams:        JamModel{DB: db},
+		Lyrics:      LyricsModel{DB: db},
 		Permissions: PermissionModel{DB: db},
+		Practice:    PracticeModel{DB: db},
+		Recordings:  RecordingModel{DB: db, Storage: store},
+		Repertoire:  RepertoireModel{DB: db},
+		Setlists:    SetlistModel{DB: db},
+		Sets:        SetModel{DB: db},
+		Sources:     SourceModel{DB: db},
+		Styles:      StyleModel{DB: db},
 		Tokens:      TokenModel{DB: db},
-		Tunes:       TuneModel{DB: db},
+		TuneAliases: TuneAliasModel{DB: db},
+		Tunes:       TuneModel{DB: db, Storage: store},
+		Tunings:     TuningModel{DB: db},
 		Users:       UserModel{DB: db},
 	}
 }
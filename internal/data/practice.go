@@ -0,0 +1,377 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+type PracticeSession struct {
+	ID              int64     `json:"id"`               // Unique integer ID for the practice session
+	UserID          int64     `json:"-"`                // ID of the user who practiced
+	TuneID          int64     `json:"tune_id"`          // ID of the tune that was practiced
+	Title           string    `json:"title"`            // Title of the tune, read from the tune itself
+	PracticedAt     time.Time `json:"practiced_at"`     // When the session was logged
+	DurationSeconds int       `json:"duration_seconds"` // How long the tune was practiced for
+	Quality         int       `json:"quality"`          // Self-rated quality from 0 (blackout) to 5 (perfect)
+	Notes           string    `json:"notes"`            // Free-form notes about the session
+}
+
+// PracticeSchedule is the SM-2 review state of a tune the user has practiced.
+type PracticeSchedule struct {
+	UserID         int64     `json:"-"`
+	TuneID         int64     `json:"tune_id"`
+	Title          string    `json:"title"`
+	Repetitions    int       `json:"repetitions"`      // Number of good practices in a row
+	EaseFactor     float64   `json:"ease_factor"`      // How quickly the interval grows, never below 1.3
+	IntervalDays   int       `json:"interval_days"`    // Days between the last review and the next
+	LastReviewedAt time.Time `json:"last_reviewed_at"` // When the tune was last practiced
+	DueAt          time.Time `json:"due_at"`           // When the tune should be practiced next
+}
+
+// PracticeWeek totals a user's practice over the week starting on WeekStart, a Monday.
+type PracticeWeek struct {
+	WeekStart string `json:"week_start"`
+	Minutes   int    `json:"minutes"`
+	Sessions  int    `json:"sessions"`
+}
+
+type PracticeStats struct {
+	CurrentStreak int            `json:"current_streak"` // Consecutive days practiced, up to today or yesterday
+	LongestStreak int            `json:"longest_streak"` // Most consecutive days ever practiced
+	Weeks         []PracticeWeek `json:"weeks"`          // Practice per week, oldest first
+}
+
+func ValidatePracticeSession(v *validator.Validator, session *PracticeSession) {
+	v.Check(session.TuneID > 0, "tune_id", "must be provided")
+
+	v.Check(session.DurationSeconds > 0, "duration_seconds", "must be greater than zero")
+	v.Check(session.DurationSeconds <= 24*60*60, "duration_seconds", "must not be more than a day")
+
+	v.Check(session.Quality >= 0 && session.Quality <= 5, "quality", "must be between 0 and 5")
+
+	v.Check(len(session.Notes) <= 1000, "notes", "must not be more than 1000 bytes long")
+}
+
+// Review applies the SM-2 algorithm to a practice of the given quality at the given
+// time. A quality of 3 or more grows the interval, anything lower starts the tune
+// over with a one day interval. The ease factor follows the quality either way.
+func (s *PracticeSchedule) Review(quality int, at time.Time) {
+	if quality >= 3 {
+		switch s.Repetitions {
+		case 0:
+			s.IntervalDays = 1
+		case 1:
+			s.IntervalDays = 6
+		default:
+			s.IntervalDays = int(math.Round(float64(s.IntervalDays) * s.EaseFactor))
+		}
+		s.Repetitions++
+	} else {
+		s.Repetitions = 0
+		s.IntervalDays = 1
+	}
+
+	q := float64(5 - quality)
+	s.EaseFactor = max(1.3, s.EaseFactor+0.1-q*(0.08+q*0.02))
+
+	s.LastReviewedAt = at
+	s.DueAt = at.AddDate(0, 0, s.IntervalDays)
+}
+
+// practiceStreaks returns the current and longest runs of consecutive days in dates,
+// which must be sorted and distinct. The current streak is zero unless the last date
+// is today or yesterday.
+func practiceStreaks(dates []time.Time, today time.Time) (current, longest int) {
+	run := 0
+
+	for i, date := range dates {
+		if i > 0 && dates[i-1].AddDate(0, 0, 1).Equal(date) {
+			run++
+		} else {
+			run = 1
+		}
+		longest = max(longest, run)
+	}
+
+	if len(dates) > 0 && !dates[len(dates)-1].Before(today.AddDate(0, 0, -1)) {
+		current = run
+	}
+
+	return current, longest
+}
+
+type PracticeModel struct {
+	DB *sql.DB
+}
+
+// Insert logs the practice session and reschedules the tune, returning its new
+// schedule. The tune's last_practiced_at is also updated if it is in the user's
+// repertoire.
+func (m PracticeModel) Insert(session *PracticeSession) (*PracticeSchedule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO practice_sessions (user_id, tune_id, duration_seconds, quality, notes)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, practiced_at`
+
+	args := []any{session.UserID, session.TuneID, session.DurationSeconds, session.Quality, session.Notes}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&session.ID, &session.PracticedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := PracticeSchedule{
+		UserID:     session.UserID,
+		TuneID:     session.TuneID,
+		Title:      session.Title,
+		EaseFactor: 2.5,
+	}
+
+	query = `
+		SELECT repetitions, ease_factor, interval_days
+		FROM practice_schedule
+		WHERE user_id = $1 AND tune_id = $2
+		FOR UPDATE`
+
+	err = tx.QueryRowContext(ctx, query, session.UserID, session.TuneID).Scan(
+		&schedule.Repetitions, &schedule.EaseFactor, &schedule.IntervalDays)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	schedule.Review(session.Quality, session.PracticedAt)
+
+	query = `
+		INSERT INTO practice_schedule (user_id, tune_id, repetitions, ease_factor, interval_days, last_reviewed_at, due_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id, tune_id) DO UPDATE
+		SET repetitions = EXCLUDED.repetitions, ease_factor = EXCLUDED.ease_factor, interval_days = EXCLUDED.interval_days,
+			last_reviewed_at = EXCLUDED.last_reviewed_at, due_at = EXCLUDED.due_at`
+
+	args = []any{schedule.UserID, schedule.TuneID, schedule.Repetitions, schedule.EaseFactor,
+		schedule.IntervalDays, schedule.LastReviewedAt, schedule.DueAt}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		UPDATE repertoire
+		SET last_practiced_at = $1, version = version + 1
+		WHERE user_id = $2 AND tune_id = $3`
+
+	_, err = tx.ExecContext(ctx, query, session.PracticedAt, session.UserID, session.TuneID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &schedule, nil
+}
+
+// GetAllForUser returns the user's practice sessions, optionally only those for the
+// given tune when tuneID is not zero.
+func (m PracticeModel) GetAllForUser(userID, tuneID int64, filters Filters) ([]*PracticeSession, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), practice_sessions.id, practice_sessions.user_id, practice_sessions.tune_id, tunes.title,
+			practice_sessions.practiced_at, practice_sessions.duration_seconds, practice_sessions.quality, practice_sessions.notes
+		FROM practice_sessions
+		INNER JOIN tunes ON tunes.id = practice_sessions.tune_id
+		WHERE practice_sessions.user_id = $1
+		AND (practice_sessions.tune_id = $2 OR $2 = 0)
+		ORDER BY %s %s, practice_sessions.id DESC
+		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, tuneID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	sessions := []*PracticeSession{}
+
+	for rows.Next() {
+		var session PracticeSession
+
+		err := rows.Scan(
+			&totalRecords,
+			&session.ID,
+			&session.UserID,
+			&session.TuneID,
+			&session.Title,
+			&session.PracticedAt,
+			&session.DurationSeconds,
+			&session.Quality,
+			&session.Notes,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		sessions = append(sessions, &session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return sessions, metadata, nil
+}
+
+// Queue returns the user's tunes that are due for practice by the given time.
+func (m PracticeModel) Queue(userID int64, until time.Time, filters Filters) ([]*PracticeSchedule, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), practice_schedule.user_id, practice_schedule.tune_id, tunes.title,
+			practice_schedule.repetitions, practice_schedule.ease_factor, practice_schedule.interval_days,
+			practice_schedule.last_reviewed_at, practice_schedule.due_at
+		FROM practice_schedule
+		INNER JOIN tunes ON tunes.id = practice_schedule.tune_id
+		WHERE practice_schedule.user_id = $1
+		AND practice_schedule.due_at <= $2
+		ORDER BY %s %s, practice_schedule.tune_id ASC
+		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, until, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	queue := []*PracticeSchedule{}
+
+	for rows.Next() {
+		var schedule PracticeSchedule
+
+		err := rows.Scan(
+			&totalRecords,
+			&schedule.UserID,
+			&schedule.TuneID,
+			&schedule.Title,
+			&schedule.Repetitions,
+			&schedule.EaseFactor,
+			&schedule.IntervalDays,
+			&schedule.LastReviewedAt,
+			&schedule.DueAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		queue = append(queue, &schedule)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return queue, metadata, nil
+}
+
+// Stats returns the user's practice streaks and the minutes practiced in each of the
+// last given number of weeks, including the current one. Days and weeks are in UTC.
+func (m PracticeModel) Stats(userID int64, weeks int) (*PracticeStats, error) {
+	stats := PracticeStats{
+		Weeks: []PracticeWeek{},
+	}
+
+	query := `
+		SELECT DISTINCT (practiced_at AT TIME ZONE 'UTC')::date
+		FROM practice_sessions
+		WHERE user_id = $1
+		ORDER BY 1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dates := []time.Time{}
+
+	for rows.Next() {
+		var date time.Time
+
+		if err := rows.Scan(&date); err != nil {
+			return nil, err
+		}
+
+		dates = append(dates, date.UTC())
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	stats.CurrentStreak, stats.LongestStreak = practiceStreaks(dates, time.Now().UTC().Truncate(24*time.Hour))
+
+	query = `
+		SELECT to_char(week, 'YYYY-MM-DD'), round(coalesce(sum(practice_sessions.duration_seconds), 0) / 60.0)::integer,
+			count(practice_sessions.id)
+		FROM generate_series(
+			date_trunc('week', NOW() AT TIME ZONE 'UTC') - ($2::integer - 1) * interval '1 week',
+			date_trunc('week', NOW() AT TIME ZONE 'UTC'),
+			interval '1 week') AS week
+		LEFT JOIN practice_sessions ON practice_sessions.user_id = $1
+			AND date_trunc('week', practice_sessions.practiced_at AT TIME ZONE 'UTC') = week
+		GROUP BY week
+		ORDER BY week`
+
+	rows, err = m.DB.QueryContext(ctx, query, userID, weeks)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var week PracticeWeek
+
+		if err := rows.Scan(&week.WeekStart, &week.Minutes, &week.Sessions); err != nil {
+			return nil, err
+		}
+
+		stats.Weeks = append(stats.Weeks, week)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
@@ -0,0 +1,205 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"jambuster.njvanhaute.com/internal/storage"
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+// RecordingMimeTypes are the audio formats accepted for recordings.
+var RecordingMimeTypes = []string{"audio/mpeg", "audio/wav", "audio/ogg", "audio/flac", "audio/mp4", "audio/aac", "audio/aiff"}
+
+type Recording struct {
+	ID              int64     `json:"id"`                         // Unique integer ID for the recording
+	TuneID          int64     `json:"tune_id"`                    // ID of the tune the recording is of
+	CreatedAt       time.Time `json:"created_at"`                 // Timestamp for when the recording is uploaded
+	Filename        string    `json:"filename"`                   // Name of the file as uploaded
+	MimeType        string    `json:"mime_type"`                  // Audio format of the file (ex: audio/mpeg)
+	SizeBytes       int64     `json:"size_bytes"`                 // Size of the file in bytes
+	DurationSeconds *float64  `json:"duration_seconds,omitempty"` // Length of the recording, if given when uploaded
+	Checksum        string    `json:"checksum"`                   // Hex-encoded SHA-256 checksum of the file
+	StorageKey      string    `json:"-"`                          // Key the file is stored under
+}
+
+func ValidateRecording(v *validator.Validator, recording *Recording) {
+	v.Check(recording.Filename != "", "file", "must have a filename")
+	v.Check(len(recording.Filename) <= 255, "file", "must have a filename not more than 255 bytes long")
+
+	v.Check(validator.PermittedValue(recording.MimeType, RecordingMimeTypes...), "file", "must be an audio file ("+strings.Join(RecordingMimeTypes, ", ")+")")
+
+	if recording.DurationSeconds != nil {
+		v.Check(*recording.DurationSeconds > 0, "duration_seconds", "must be greater than zero")
+		v.Check(*recording.DurationSeconds <= 4*60*60, "duration_seconds", "must not be more than 4 hours")
+	}
+}
+
+type RecordingModel struct {
+	DB      *sql.DB
+	Storage storage.Storage
+}
+
+// Insert stores the file read from body and adds the recording, setting its size and
+// checksum from what was read. The file is removed again if the recording cannot be
+// added, and ErrRecordNotFound is returned if the tune no longer exists.
+func (m RecordingModel) Insert(recording *Recording, body io.Reader) error {
+	file, err := storeFile(m.Storage, fmt.Sprintf("recordings/%d", recording.TuneID), body)
+	if err != nil {
+		return err
+	}
+
+	recording.StorageKey = file.key
+	recording.SizeBytes = file.size
+	recording.Checksum = file.checksum
+
+	query := `
+		INSERT INTO recordings (tune_id, filename, mime_type, size_bytes, duration_seconds, checksum, storage_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`
+
+	args := []any{recording.TuneID, recording.Filename, recording.MimeType, recording.SizeBytes, recording.DurationSeconds,
+		recording.Checksum, recording.StorageKey}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&recording.ID, &recording.CreatedAt)
+	if err != nil {
+		m.Storage.Delete(recording.StorageKey)
+
+		switch {
+		case err.Error() == `pq: insert or update on table "recordings" violates foreign key constraint "recordings_tune_id_fkey"`:
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m RecordingModel) Get(tuneID, id int64) (*Recording, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, tune_id, created_at, filename, mime_type, size_bytes, duration_seconds, checksum, storage_key
+		FROM recordings
+		WHERE id = $1 AND tune_id = $2`
+
+	var recording Recording
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, tuneID).Scan(
+		&recording.ID,
+		&recording.TuneID,
+		&recording.CreatedAt,
+		&recording.Filename,
+		&recording.MimeType,
+		&recording.SizeBytes,
+		&recording.DurationSeconds,
+		&recording.Checksum,
+		&recording.StorageKey,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &recording, nil
+}
+
+func (m RecordingModel) GetAllForTune(tuneID int64) ([]*Recording, error) {
+	query := `
+		SELECT id, tune_id, created_at, filename, mime_type, size_bytes, duration_seconds, checksum, storage_key
+		FROM recordings
+		WHERE tune_id = $1
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, tuneID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recordings := []*Recording{}
+
+	for rows.Next() {
+		var recording Recording
+
+		err := rows.Scan(
+			&recording.ID,
+			&recording.TuneID,
+			&recording.CreatedAt,
+			&recording.Filename,
+			&recording.MimeType,
+			&recording.SizeBytes,
+			&recording.DurationSeconds,
+			&recording.Checksum,
+			&recording.StorageKey,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		recordings = append(recordings, &recording)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return recordings, nil
+}
+
+// Open returns the recording's file for reading.
+func (m RecordingModel) Open(recording *Recording) (io.ReadSeekCloser, error) {
+	return m.Storage.Open(recording.StorageKey)
+}
+
+// Delete removes the recording and then its file. If the file cannot be removed the
+// error wraps ErrStorageCleanup.
+func (m RecordingModel) Delete(tuneID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM recordings
+		WHERE id = $1 AND tune_id = $2
+		RETURNING storage_key`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var key string
+
+	err := m.DB.QueryRowContext(ctx, query, id, tuneID).Scan(&key)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return removeFiles(m.Storage, []string{key})
+}
@@ -0,0 +1,250 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+var ErrDuplicateRepertoireEntry = errors.New("duplicate repertoire entry")
+
+var ProficiencyLevels = []string{"learning", "can_follow", "can_lead"}
+
+type RepertoireEntry struct {
+	UserID          int64      `json:"-"`                 // ID of the user who knows the tune
+	TuneID          int64      `json:"tune_id"`           // ID of the tune
+	Title           string     `json:"title"`             // Title of the tune, read from the tune itself
+	CreatedAt       time.Time  `json:"-"`                 // Timestamp for when the tune is added to the repertoire
+	Proficiency     string     `json:"proficiency"`       // One of learning, can_follow or can_lead
+	PreferredKey    *Key       `json:"preferred_key"`     // Key the user prefers to play the tune in, if any
+	Instrument      string     `json:"instrument"`        // Instrument the user plays the tune on (ex: fiddle)
+	LastPracticedAt *time.Time `json:"last_practiced_at"` // When the user last practiced the tune, if ever
+	Version         int32      `json:"version"`           // The version number starts at 1 and will be incremented each time the entry is updated
+}
+
+func ValidateRepertoireEntry(v *validator.Validator, entry *RepertoireEntry) {
+	v.Check(entry.TuneID > 0, "tune_id", "must be provided")
+
+	v.Check(entry.Proficiency != "", "proficiency", "must be provided")
+	v.Check(validator.PermittedValue(entry.Proficiency, ProficiencyLevels...), "proficiency", "must be one of "+strings.Join(ProficiencyLevels, ", "))
+
+	v.Check(len(entry.Instrument) <= 100, "instrument", "must not be more than 100 bytes long")
+
+	if entry.LastPracticedAt != nil {
+		v.Check(entry.LastPracticedAt.Before(time.Now().Add(time.Minute)), "last_practiced_at", "must not be in the future")
+	}
+}
+
+// TunePlayer reports how one of a group of players knows a tune, as returned when
+// searching for the tunes the whole group has in common.
+type TunePlayer struct {
+	UserID       int64  `json:"user_id"`
+	Name         string `json:"name"`
+	Proficiency  string `json:"proficiency"`
+	PreferredKey *Key   `json:"preferred_key"`
+	Instrument   string `json:"instrument"`
+}
+
+type RepertoireModel struct {
+	DB *sql.DB
+}
+
+func (m RepertoireModel) Insert(entry *RepertoireEntry) error {
+	query := `
+		INSERT INTO repertoire (user_id, tune_id, proficiency, preferred_key, instrument, last_practiced_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at, version`
+
+	args := []any{entry.UserID, entry.TuneID, entry.Proficiency, entry.PreferredKey, entry.Instrument, entry.LastPracticedAt}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&entry.CreatedAt, &entry.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "repertoire_pkey"`:
+			return ErrDuplicateRepertoireEntry
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanRepertoireEntry reads a row selected with the repertoireColumns into entry.
+func scanRepertoireEntry(scan func(dest ...any) error, entry *RepertoireEntry, extra ...any) error {
+	var preferredKey sql.NullString
+
+	dest := append(extra, &entry.UserID, &entry.TuneID, &entry.Title, &entry.CreatedAt, &entry.Proficiency,
+		&preferredKey, &entry.Instrument, &entry.LastPracticedAt, &entry.Version)
+
+	err := scan(dest...)
+	if err != nil {
+		return err
+	}
+
+	if preferredKey.Valid {
+		key, err := ParseKey(preferredKey.String)
+		if err != nil {
+			return err
+		}
+		entry.PreferredKey = &key
+	}
+
+	return nil
+}
+
+// The columns read by scanRepertoireEntry, with the title joined in from the tunes table
+const repertoireColumns = `repertoire.user_id, repertoire.tune_id, tunes.title, repertoire.created_at, repertoire.proficiency,
+			repertoire.preferred_key, repertoire.instrument, repertoire.last_practiced_at, repertoire.version`
+
+func (m RepertoireModel) Get(userID, tuneID int64) (*RepertoireEntry, error) {
+	if userID < 1 || tuneID < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + repertoireColumns + `
+		FROM repertoire
+		INNER JOIN tunes ON tunes.id = repertoire.tune_id
+		WHERE repertoire.user_id = $1 AND repertoire.tune_id = $2`
+
+	var entry RepertoireEntry
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := scanRepertoireEntry(m.DB.QueryRowContext(ctx, query, userID, tuneID).Scan, &entry)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &entry, nil
+}
+
+func (m RepertoireModel) GetAllForUser(userID int64, proficiency string, filters Filters) ([]*RepertoireEntry, Metadata, error) {
+	args := []any{userID, proficiency, filters.limit(), filters.offset()}
+
+	// Proficiency levels sort in the order they are learned rather than alphabetically
+	sortColumn := filters.sortColumn()
+	if sortColumn == "proficiency" {
+		sortColumn = "array_position($5::text[], repertoire.proficiency)"
+		args = append(args, pq.Array(ProficiencyLevels))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), %s
+		FROM repertoire
+		INNER JOIN tunes ON tunes.id = repertoire.tune_id
+		WHERE repertoire.user_id = $1
+		AND (repertoire.proficiency = $2 OR $2 = '')
+		ORDER BY %s %s, repertoire.tune_id ASC
+		LIMIT $3 OFFSET $4`, repertoireColumns, sortColumn, filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	entries := []*RepertoireEntry{}
+
+	for rows.Next() {
+		var entry RepertoireEntry
+
+		err := scanRepertoireEntry(rows.Scan, &entry, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return entries, metadata, nil
+}
+
+func (m RepertoireModel) Update(entry *RepertoireEntry) error {
+	query := `
+		UPDATE repertoire
+		SET proficiency = $1, preferred_key = $2, instrument = $3, last_practiced_at = $4, version = version + 1
+		WHERE user_id = $5 AND tune_id = $6 AND version = $7
+		RETURNING version`
+
+	args := []any{
+		entry.Proficiency,
+		entry.PreferredKey,
+		entry.Instrument,
+		entry.LastPracticedAt,
+		entry.UserID,
+		entry.TuneID,
+		entry.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&entry.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m RepertoireModel) Delete(userID, tuneID int64) error {
+	if userID < 1 || tuneID < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM repertoire
+		WHERE user_id = $1 AND tune_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, tuneID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
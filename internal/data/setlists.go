@@ -0,0 +1,388 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+type SetlistEntry struct {
+	TuneID          int64  `json:"tune_id"`          // ID of the tune
+	Title           string `json:"title"`            // Title of the tune, read from the tune itself
+	Key             Key    `json:"key"`              // Key the tune is played in, the tune's first key unless one is chosen
+	KeyChosen       bool   `json:"key_chosen"`       // Whether the key was chosen for the setlist rather than following the tune's keys
+	DurationSeconds int    `json:"duration_seconds"` // Estimated time to play the tune, 0 when there is no estimate
+	Notes           string `json:"notes"`            // Notes for the band (ex: fiddle kicks off, tag the ending)
+}
+
+type Setlist struct {
+	ID                   int64          `json:"id"`                     // Unique integer ID for the setlist
+	CreatedAt            time.Time      `json:"-"`                      // Timestamp for when the setlist is added to our database
+	Name                 string         `json:"name"`                   // Setlist name (ex: Station Inn, first set)
+	Notes                string         `json:"notes"`                  // Notes for the whole gig
+	Entries              []SetlistEntry `json:"entries"`                // Entries in the order they are played
+	TotalDurationSeconds int            `json:"total_duration_seconds"` // Sum of the estimated durations of the entries
+	UntimedEntries       int            `json:"untimed_entries"`        // Number of entries without a duration estimate
+	Version              int32          `json:"version"`                // The version number starts at 1 and will be incremented each time the setlist is updated
+}
+
+// SetlistIssue is a problem with the running order of a setlist, reported against the
+// second of the two entries involved.
+type SetlistIssue struct {
+	Position int    `json:"position"` // Position of the entry, starting at 1
+	Kind     string `json:"kind"`     // Either same_key or awkward_transition
+	Message  string `json:"message"`
+}
+
+func ValidateSetlist(v *validator.Validator, setlist *Setlist) {
+	v.Check(setlist.Name != "", "name", "must be provided")
+	v.Check(len(setlist.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(len(setlist.Notes) <= 5000, "notes", "must not be more than 5000 bytes long")
+
+	v.Check(setlist.Entries != nil, "entries", "must be provided")
+	v.Check(len(setlist.Entries) <= 100, "entries", "must not contain more than 100 entries")
+
+	for _, entry := range setlist.Entries {
+		v.Check(entry.DurationSeconds >= 0, "entries", "must not have a negative duration")
+		v.Check(entry.DurationSeconds <= 3600, "entries", "must not have a duration of more than an hour")
+		v.Check(len(entry.Notes) <= 1000, "entries", "must not have notes more than 1000 bytes long")
+	}
+}
+
+// computeTotals fills in the setlist's total duration and its count of entries
+// without an estimate.
+func (s *Setlist) computeTotals() {
+	s.TotalDurationSeconds, s.UntimedEntries = 0, 0
+
+	for _, entry := range s.Entries {
+		s.TotalDurationSeconds += entry.DurationSeconds
+
+		if entry.DurationSeconds == 0 {
+			s.UntimedEntries++
+		}
+	}
+}
+
+// Analyze flags consecutive entries played in the same key, which makes for a flat
+// stretch of the show, and key changes of five or six steps around the circle of
+// fifths (a semitone or a tritone), which usually mean retuning or moving a capo
+// between tunes.
+func (s *Setlist) Analyze() []SetlistIssue {
+	issues := []SetlistIssue{}
+
+	for i := 1; i < len(s.Entries); i++ {
+		prev, next := s.Entries[i-1], s.Entries[i]
+
+		switch {
+		case prev.Key.EnharmonicTo(next.Key):
+			issues = append(issues, SetlistIssue{
+				Position: i + 1,
+				Kind:     "same_key",
+				Message:  fmt.Sprintf("%q follows %q in the same key (%s)", next.Title, prev.Title, next.Key),
+			})
+		case FifthsApart(prev.Key, next.Key) >= 5:
+			issues = append(issues, SetlistIssue{
+				Position: i + 1,
+				Kind:     "awkward_transition",
+				Message:  fmt.Sprintf("%q moves from %s to %s after %q", next.Title, prev.Key, next.Key, prev.Title),
+			})
+		}
+	}
+
+	return issues
+}
+
+type SetlistModel struct {
+	DB *sql.DB
+}
+
+// writeEntries replaces the entries in the setlist with the ones in setlist.Entries,
+// numbering their positions from 1. Keys that were not chosen are left NULL so that
+// the entries follow any later change to their tune's keys.
+func (s *Setlist) writeEntries(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM setlist_entries WHERE setlist_id = $1`, s.ID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO setlist_entries (setlist_id, position, tune_id, key, duration_seconds, notes)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+
+	for i, entry := range s.Entries {
+		var key *Key
+		if entry.KeyChosen {
+			key = &entry.Key
+		}
+
+		_, err := tx.ExecContext(ctx, query, s.ID, i+1, entry.TuneID, key, entry.DurationSeconds, entry.Notes)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getEntries returns the entries in each of the given setlists in running order.
+func (m SetlistModel) getEntries(ctx context.Context, setlistIDs []int64) (map[int64][]SetlistEntry, error) {
+	query := `
+		SELECT setlist_entries.setlist_id, setlist_entries.tune_id, tunes.title,
+			coalesce(setlist_entries.key, tunes.keys[1]), setlist_entries.key IS NOT NULL,
+			setlist_entries.duration_seconds, setlist_entries.notes
+		FROM setlist_entries
+		INNER JOIN tunes ON tunes.id = setlist_entries.tune_id
+		WHERE setlist_entries.setlist_id = ANY($1)
+		ORDER BY setlist_entries.setlist_id, setlist_entries.position`
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(setlistIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make(map[int64][]SetlistEntry)
+
+	for rows.Next() {
+		var setlistID int64
+		var entry SetlistEntry
+		var key string
+
+		err := rows.Scan(&setlistID, &entry.TuneID, &entry.Title, &key, &entry.KeyChosen, &entry.DurationSeconds, &entry.Notes)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.Key, err = ParseKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		entries[setlistID] = append(entries[setlistID], entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (m SetlistModel) Insert(setlist *Setlist) error {
+	query := `
+		INSERT INTO setlists (name, notes)
+		VALUES ($1, $2)
+		RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, setlist.Name, setlist.Notes).Scan(&setlist.ID, &setlist.CreatedAt, &setlist.Version)
+	if err != nil {
+		return err
+	}
+
+	err = setlist.writeEntries(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	setlist.computeTotals()
+
+	return tx.Commit()
+}
+
+func (m SetlistModel) Get(id int64) (*Setlist, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, name, notes, version
+		FROM setlists
+		WHERE id = $1`
+
+	var setlist Setlist
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&setlist.ID,
+		&setlist.CreatedAt,
+		&setlist.Name,
+		&setlist.Notes,
+		&setlist.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	entries, err := m.getEntries(ctx, []int64{setlist.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	setlist.Entries = entries[setlist.ID]
+	if setlist.Entries == nil {
+		setlist.Entries = []SetlistEntry{}
+	}
+
+	setlist.computeTotals()
+
+	return &setlist, nil
+}
+
+func (m SetlistModel) GetAll(name string, filters Filters) ([]*Setlist, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, name, notes, version
+		FROM setlists
+		WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		ORDER BY %s %s, id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	setlists := []*Setlist{}
+	setlistIDs := []int64{}
+
+	for rows.Next() {
+		var setlist Setlist
+
+		err := rows.Scan(
+			&totalRecords,
+			&setlist.ID,
+			&setlist.CreatedAt,
+			&setlist.Name,
+			&setlist.Notes,
+			&setlist.Version,
+		)
+
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		setlists = append(setlists, &setlist)
+		setlistIDs = append(setlistIDs, setlist.ID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	entries, err := m.getEntries(ctx, setlistIDs)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	for _, setlist := range setlists {
+		setlist.Entries = entries[setlist.ID]
+		if setlist.Entries == nil {
+			setlist.Entries = []SetlistEntry{}
+		}
+
+		setlist.computeTotals()
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return setlists, metadata, nil
+}
+
+func (m SetlistModel) Update(setlist *Setlist) error {
+	query := `
+		UPDATE setlists
+		SET name = $1, notes = $2, version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING version`
+
+	args := []any{
+		setlist.Name,
+		setlist.Notes,
+		setlist.ID,
+		setlist.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&setlist.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	err = setlist.writeEntries(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	setlist.computeTotals()
+
+	return tx.Commit()
+}
+
+func (m SetlistModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM setlists
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,374 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+type SetTune struct {
+	TuneID        int64         `json:"tune_id"`        // ID of the tune
+	Title         string        `json:"title"`          // Title of the tune, read from the tune itself
+	TimeSignature TimeSignature `json:"time_signature"` // Time signature of the tune, read from the tune itself
+	Key           *Key          `json:"key,omitempty"`  // Key the tune is played in within the set, if not its usual key
+	Repeats       int           `json:"repeats"`        // Number of times through the tune before moving on
+}
+
+type Set struct {
+	ID        int64     `json:"id"`      // Unique integer ID for the set
+	CreatedAt time.Time `json:"-"`       // Timestamp for when the set is added to our database
+	Name      string    `json:"name"`    // Set name (ex: The Kesh set)
+	Tunes     []SetTune `json:"tunes"`   // Tunes in the order they are played
+	Version   int32     `json:"version"` // The version number starts at 1 and will be incremented each time the set is updated
+}
+
+// SetMembership is a set that a tune is played in, as reported on the tune.
+type SetMembership struct {
+	ID       int64  `json:"id"`       // ID of the set
+	Name     string `json:"name"`     // Name of the set
+	Position int    `json:"position"` // Position of the tune in the set, starting at 1
+}
+
+func ValidateSet(v *validator.Validator, set *Set) {
+	v.Check(set.Name != "", "name", "must be provided")
+	v.Check(len(set.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	v.Check(set.Tunes != nil, "tunes", "must be provided")
+	v.Check(len(set.Tunes) >= 1, "tunes", "must contain at least 1 tune")
+	v.Check(len(set.Tunes) <= 10, "tunes", "must not contain more than 10 tunes")
+
+	for _, tune := range set.Tunes {
+		v.Check(tune.Repeats >= 1, "tunes", "must have a repeat count of at least 1 for every tune")
+		v.Check(tune.Repeats <= 10, "tunes", "must not have a repeat count of more than 10")
+	}
+}
+
+// Warnings returns the problems with the set that do not stop it from being saved,
+// which are the places where consecutive tunes change meter. The tunes' titles and
+// time signatures must already be filled in.
+func (s *Set) Warnings() []string {
+	var warnings []string
+
+	for i := 1; i < len(s.Tunes); i++ {
+		prev, next := s.Tunes[i-1], s.Tunes[i]
+
+		if prev.TimeSignature != next.TimeSignature {
+			warnings = append(warnings, fmt.Sprintf("meter changes from %s to %s between %q and %q",
+				prev.TimeSignature, next.TimeSignature, prev.Title, next.Title))
+		}
+	}
+
+	return warnings
+}
+
+type SetModel struct {
+	DB *sql.DB
+}
+
+// writeTunes replaces the tunes in the set with the ones in set.Tunes, numbering their
+// positions from 1.
+func (s *Set) writeTunes(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM set_tunes WHERE set_id = $1`, s.ID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO set_tunes (set_id, position, tune_id, key, repeats)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	for i, tune := range s.Tunes {
+		_, err := tx.ExecContext(ctx, query, s.ID, i+1, tune.TuneID, tune.Key, tune.Repeats)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getTunes returns the tunes in each of the given sets in the order they are played.
+func (m SetModel) getTunes(ctx context.Context, setIDs []int64) (map[int64][]SetTune, error) {
+	query := `
+		SELECT set_tunes.set_id, set_tunes.tune_id, tunes.title, tunes.time_signature, set_tunes.key, set_tunes.repeats
+		FROM set_tunes
+		INNER JOIN tunes ON tunes.id = set_tunes.tune_id
+		WHERE set_tunes.set_id = ANY($1)
+		ORDER BY set_tunes.set_id, set_tunes.position`
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(setIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tunes := make(map[int64][]SetTune)
+
+	for rows.Next() {
+		var setID int64
+		var tune SetTune
+		var key sql.NullString
+
+		err := rows.Scan(&setID, &tune.TuneID, &tune.Title, &tune.TimeSignature, &key, &tune.Repeats)
+		if err != nil {
+			return nil, err
+		}
+
+		if key.Valid {
+			k, err := ParseKey(key.String)
+			if err != nil {
+				return nil, err
+			}
+			tune.Key = &k
+		}
+
+		tunes[setID] = append(tunes[setID], tune)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tunes, nil
+}
+
+func (m SetModel) Insert(set *Set) error {
+	query := `
+		INSERT INTO sets (name)
+		VALUES ($1)
+		RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, set.Name).Scan(&set.ID, &set.CreatedAt, &set.Version)
+	if err != nil {
+		return err
+	}
+
+	err = set.writeTunes(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m SetModel) Get(id int64) (*Set, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, name, version
+		FROM sets
+		WHERE id = $1`
+
+	var set Set
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&set.ID,
+		&set.CreatedAt,
+		&set.Name,
+		&set.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	tunes, err := m.getTunes(ctx, []int64{set.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	set.Tunes = tunes[set.ID]
+	if set.Tunes == nil {
+		set.Tunes = []SetTune{}
+	}
+
+	return &set, nil
+}
+
+func (m SetModel) GetAll(name string, tuneID int64, filters Filters) ([]*Set, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, name, version
+		FROM sets
+		WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		AND (EXISTS (SELECT 1 FROM set_tunes WHERE set_tunes.set_id = sets.id AND tune_id = $2) OR $2 = 0)
+		ORDER BY %s %s, id ASC
+		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, tuneID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	sets := []*Set{}
+	setIDs := []int64{}
+
+	for rows.Next() {
+		var set Set
+
+		err := rows.Scan(
+			&totalRecords,
+			&set.ID,
+			&set.CreatedAt,
+			&set.Name,
+			&set.Version,
+		)
+
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		sets = append(sets, &set)
+		setIDs = append(setIDs, set.ID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	tunes, err := m.getTunes(ctx, setIDs)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	for _, set := range sets {
+		set.Tunes = tunes[set.ID]
+		if set.Tunes == nil {
+			set.Tunes = []SetTune{}
+		}
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return sets, metadata, nil
+}
+
+// GetAllForTune returns every set the tune is played in, ordered by name.
+func (m SetModel) GetAllForTune(tuneID int64) ([]SetMembership, error) {
+	query := `
+		SELECT sets.id, sets.name, set_tunes.position
+		FROM sets
+		INNER JOIN set_tunes ON set_tunes.set_id = sets.id
+		WHERE set_tunes.tune_id = $1
+		ORDER BY sets.name, sets.id, set_tunes.position`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, tuneID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sets := []SetMembership{}
+
+	for rows.Next() {
+		var set SetMembership
+
+		err := rows.Scan(&set.ID, &set.Name, &set.Position)
+		if err != nil {
+			return nil, err
+		}
+
+		sets = append(sets, set)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sets, nil
+}
+
+func (m SetModel) Update(set *Set) error {
+	query := `
+		UPDATE sets
+		SET name = $1, version = version + 1
+		WHERE id = $2 AND version = $3
+		RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, set.Name, set.ID, set.Version).Scan(&set.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	err = set.writeTunes(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m SetModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM sets
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Points scored by a similar tune for each thing it has in common with the tune it was
+// found for. A time signature match replaces a meter class match and a structure match
+// replaces a part count match, rather than adding to them.
+const (
+	similarStylePoints         = 3 // For each style in common
+	similarKeyPoints           = 3 // For each key in common, in any spelling
+	similarRelativeKeyPoints   = 1 // For each relative major or minor of one of the tune's keys
+	similarTimeSignaturePoints = 2
+	similarMeterClassPoints    = 1
+	similarStructurePoints     = 2
+	similarPartCountPoints     = 1
+)
+
+// SimilarityReason is one of the things a similar tune has in common with the tune it
+// was found for.
+type SimilarityReason struct {
+	Match  string   `json:"match"`  // What matched: styles, keys, relative_keys, time_signature, meter_class, structure or part_count
+	Values []string `json:"values"` // The similar tune's values that matched (ex: ["D major"] for keys)
+	Points int      `json:"points"` // What the match added to the score
+}
+
+// SimilarTune is a tune recommended from another one, with the reasons it was picked.
+type SimilarTune struct {
+	ID            int64              `json:"id"`
+	Title         string             `json:"title"`
+	Styles        []string           `json:"styles"`
+	TuneType      *string            `json:"tune_type"`
+	Keys          []Key              `json:"keys"`
+	TimeSignature TimeSignature      `json:"time_signature"`
+	Structure     string             `json:"structure"`
+	Score         int                `json:"score"`   // Sum of the points of every reason
+	Reasons       []SimilarityReason `json:"reasons"` // What the tune has in common, highest scoring first
+}
+
+// similarKeyArgs returns every spelling of the tune's keys, and every spelling of their
+// relative majors and minors that is not one of the tune's keys already.
+func (tune *Tune) similarKeyArgs() (keys []string, relativeKeys []string) {
+	keys, relativeKeys = []string{}, []string{}
+
+	for _, key := range tune.Keys {
+		for _, spelling := range key.Enharmonics() {
+			if !slices.Contains(keys, spelling.String()) {
+				keys = append(keys, spelling.String())
+			}
+		}
+	}
+
+	for _, key := range tune.Keys {
+		for _, relative := range []Key{key.RelativeMajor(), key.RelativeMinor()} {
+			for _, spelling := range relative.Enharmonics() {
+				s := spelling.String()
+				if !slices.Contains(keys, s) && !slices.Contains(relativeKeys, s) {
+					relativeKeys = append(relativeKeys, s)
+				}
+			}
+		}
+	}
+
+	return keys, relativeKeys
+}
+
+// GetSimilar returns the other tunes ranked by how much they have in common with the
+// given one. Only tunes sharing at least a style or a key, relative keys included, are
+// candidates, so that they can be found through the GIN indexes on styles and keys;
+// the time signature and structure then add to their score.
+func (t TuneModel) GetSimilar(tune *Tune, filters Filters) ([]*SimilarTune, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, title, styles, tune_type, keys, time_signature, structure,
+			shared_styles, shared_keys, relative_keys, same_time_signature, same_meter_class, same_structure, same_part_count,
+			score
+		FROM (
+			SELECT *,
+				$9::integer * cardinality(shared_styles)
+				+ $10::integer * cardinality(shared_keys)
+				+ $11::integer * cardinality(relative_keys)
+				+ CASE WHEN same_time_signature THEN $12::integer WHEN same_meter_class THEN $13::integer ELSE 0 END
+				+ CASE WHEN same_structure THEN $14::integer WHEN same_part_count THEN $15::integer ELSE 0 END AS score
+			FROM (
+				SELECT id, title, styles, tune_type, keys, time_signature, structure,
+					ARRAY(SELECT style FROM unnest(tunes.styles) AS style WHERE style = ANY($2)) AS shared_styles,
+					ARRAY(SELECT tune_key FROM unnest(tunes.keys) AS tune_key WHERE tune_key = ANY($3)) AS shared_keys,
+					ARRAY(SELECT tune_key FROM unnest(tunes.keys) AS tune_key WHERE tune_key = ANY($4)) AS relative_keys,
+					time_signature = $5 AS same_time_signature,
+					coalesce(meter_class = $6, false) AS same_meter_class,
+					structure = $7 AS same_structure,
+					coalesce(part_count = $8, false) AS same_part_count
+				FROM tunes
+				WHERE id <> $1
+				AND (styles && $2 OR keys && $3 OR keys && $4)
+			) AS candidates
+		) AS scored
+		ORDER BY %s %s, id ASC
+		LIMIT $16 OFFSET $17`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	styles := tune.Styles
+	if styles == nil {
+		styles = []string{}
+	}
+
+	keys, relativeKeys := tune.similarKeyArgs()
+	partCount, _ := tune.parseStructure()
+
+	args := []any{tune.ID, pq.Array(styles), pq.Array(keys), pq.Array(relativeKeys),
+		tune.TimeSignature, tune.TimeSignature.MeterClass(), tune.Structure, partCount,
+		similarStylePoints, similarKeyPoints, similarRelativeKeyPoints,
+		similarTimeSignaturePoints, similarMeterClassPoints, similarStructurePoints, similarPartCountPoints,
+		filters.limit(), filters.offset()}
+
+	rows, err := t.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	similar := []*SimilarTune{}
+
+	for rows.Next() {
+		var s SimilarTune
+		var keyStrings, sharedStyles, sharedKeys, relatives []string
+		var sameTimeSignature, sameMeterClass, sameStructure, samePartCount bool
+
+		err := rows.Scan(
+			&totalRecords,
+			&s.ID,
+			&s.Title,
+			pq.Array(&s.Styles),
+			&s.TuneType,
+			pq.Array(&keyStrings),
+			&s.TimeSignature,
+			&s.Structure,
+			pq.Array(&sharedStyles),
+			pq.Array(&sharedKeys),
+			pq.Array(&relatives),
+			&sameTimeSignature,
+			&sameMeterClass,
+			&sameStructure,
+			&samePartCount,
+			&s.Score,
+		)
+
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		for _, keyString := range keyStrings {
+			key, err := ParseKey(keyString)
+			if err != nil {
+				return nil, Metadata{}, err
+			}
+			s.Keys = append(s.Keys, key)
+		}
+
+		s.Reasons = []SimilarityReason{}
+
+		addReason := func(match string, values []string, points int) {
+			if len(values) > 0 {
+				s.Reasons = append(s.Reasons, SimilarityReason{Match: match, Values: values, Points: points * len(values)})
+			}
+		}
+
+		addReason("styles", sharedStyles, similarStylePoints)
+		addReason("keys", sharedKeys, similarKeyPoints)
+		addReason("relative_keys", relatives, similarRelativeKeyPoints)
+
+		switch {
+		case sameTimeSignature:
+			addReason("time_signature", []string{s.TimeSignature.String()}, similarTimeSignaturePoints)
+		case sameMeterClass:
+			addReason("meter_class", []string{s.TimeSignature.MeterClass()}, similarMeterClassPoints)
+		}
+
+		switch {
+		case sameStructure:
+			addReason("structure", []string{s.Structure}, similarStructurePoints)
+		case samePartCount:
+			addReason("part_count", []string{fmt.Sprint(*partCount)}, similarPartCountPoints)
+		}
+
+		slices.SortStableFunc(s.Reasons, func(a, b SimilarityReason) int {
+			return b.Points - a.Points
+		})
+
+		similar = append(similar, &s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return similar, metadata, nil
+}
@@ -0,0 +1,251 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+var ErrDuplicateSource = errors.New("duplicate source")
+
+var SourceKinds = []string{"player", "recording", "collection", "region"}
+
+type Source struct {
+	ID          int64     `json:"id"`          // Unique integer ID for the source
+	CreatedAt   time.Time `json:"-"`           // Timestamp for when the source is added to our database
+	Name        string    `json:"name"`        // Source name (ex: Tommy Jarrell, O'Neill's Music of Ireland)
+	Kind        string    `json:"kind"`        // One of player, recording, collection or region
+	Description string    `json:"description"` // Optional details such as where or when the tune was learned
+	Version     int32     `json:"version"`     // The version number starts at 1 and will be incremented each time the source is updated
+}
+
+func ValidateSource(v *validator.Validator, source *Source) {
+	v.Check(source.Name != "", "name", "must be provided")
+	v.Check(len(source.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	v.Check(source.Kind != "", "kind", "must be provided")
+	v.Check(validator.PermittedValue(source.Kind, SourceKinds...), "kind", "must be one of "+strings.Join(SourceKinds, ", "))
+
+	v.Check(len(source.Description) <= 5000, "description", "must not be more than 5000 bytes long")
+}
+
+type SourceModel struct {
+	DB *sql.DB
+}
+
+func (m SourceModel) Insert(source *Source) error {
+	query := `
+		INSERT INTO sources (name, kind, description)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, version`
+
+	args := []any{source.Name, source.Kind, source.Description}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&source.ID, &source.CreatedAt, &source.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "sources_name_kind_key"`:
+			return ErrDuplicateSource
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m SourceModel) Get(id int64) (*Source, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, name, kind, description, version
+		FROM sources
+		WHERE id = $1`
+
+	var source Source
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&source.ID,
+		&source.CreatedAt,
+		&source.Name,
+		&source.Kind,
+		&source.Description,
+		&source.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &source, nil
+}
+
+// GetByIDs returns the sources with the given IDs, ordered by name. IDs that do not
+// exist are skipped, so callers compare the lengths to detect them.
+func (m SourceModel) GetByIDs(ids []int64) ([]Source, error) {
+	query := `
+		SELECT id, created_at, name, kind, description, version
+		FROM sources
+		WHERE id = ANY($1)
+		ORDER BY name, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sources := []Source{}
+
+	for rows.Next() {
+		var source Source
+
+		err := rows.Scan(&source.ID, &source.CreatedAt, &source.Name, &source.Kind, &source.Description, &source.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		sources = append(sources, source)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sources, nil
+}
+
+func (m SourceModel) GetAll(name string, kind string, filters Filters) ([]*Source, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, name, kind, description, version
+		FROM sources
+		WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		AND (kind = $2 OR $2 = '')
+		ORDER BY %s %s, id ASC
+		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, kind, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	sources := []*Source{}
+
+	for rows.Next() {
+		var source Source
+
+		err := rows.Scan(
+			&totalRecords,
+			&source.ID,
+			&source.CreatedAt,
+			&source.Name,
+			&source.Kind,
+			&source.Description,
+			&source.Version,
+		)
+
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		sources = append(sources, &source)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return sources, metadata, nil
+}
+
+func (m SourceModel) Update(source *Source) error {
+	query := `
+		UPDATE sources
+		SET name = $1, kind = $2, description = $3, version = version + 1
+		WHERE id = $4 AND version = $5
+		RETURNING version`
+
+	args := []any{
+		source.Name,
+		source.Kind,
+		source.Description,
+		source.ID,
+		source.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&source.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "sources_name_kind_key"`:
+			return ErrDuplicateSource
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m SourceModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM sources
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
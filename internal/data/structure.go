@@ -0,0 +1,115 @@
+package data
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidStructureFormat = errors.New("invalid structure format")
+
+type Part struct {
+	Name string `json:"name"`           // Part letter, optionally followed by primes (ex: A, B')
+	Bars int    `json:"bars,omitempty"` // Number of bars in the part, when known
+}
+
+type ParsedStructure struct {
+	Parts         []Part `json:"parts"`                // Parts in the order they are played
+	DistinctParts int    `json:"distinct_parts"`       // Number of different parts (ex: 2 for AABB)
+	TotalBars     int    `json:"total_bars,omitempty"` // Total number of bars, only present when every part's length is known
+	Crooked       bool   `json:"crooked"`              // Whether a part has an irregular number of bars
+}
+
+// ParseStructure parses a tune structure written as a sequence of part letters with
+// optional bar counts in parentheses, such as "AABB" or "A(8)A(8)B(10)B(10)". A bar
+// count given for one occurrence of a part applies to the others, so "A(8)ABB" is an
+// 8 bar A part played twice.
+//
+// A tune is crooked when a part's length is not a multiple of four bars, or when the
+// same part is given different lengths.
+func ParseStructure(s string) (*ParsedStructure, error) {
+	var parts []Part
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == ' ' || c == '-':
+			i++
+		case c >= 'A' && c <= 'Z':
+			part := Part{Name: string(c)}
+			i++
+
+			for i < len(s) && s[i] == '\'' {
+				part.Name += "'"
+				i++
+			}
+
+			if i < len(s) && s[i] == '(' {
+				end := strings.IndexByte(s[i:], ')')
+				if end < 0 {
+					return nil, ErrInvalidStructureFormat
+				}
+
+				bars, err := strconv.Atoi(s[i+1 : i+end])
+				if err != nil || bars < 1 || bars > 999 {
+					return nil, ErrInvalidStructureFormat
+				}
+
+				part.Bars = bars
+				i += end + 1
+			}
+
+			parts = append(parts, part)
+		default:
+			return nil, ErrInvalidStructureFormat
+		}
+	}
+
+	if len(parts) == 0 {
+		return nil, ErrInvalidStructureFormat
+	}
+
+	structure := &ParsedStructure{Parts: parts}
+
+	bars := make(map[string]int)
+	for _, part := range parts {
+		if part.Bars == 0 {
+			continue
+		}
+
+		if known, ok := bars[part.Name]; ok && known != part.Bars {
+			structure.Crooked = true
+		}
+		bars[part.Name] = part.Bars
+
+		if part.Bars%4 != 0 {
+			structure.Crooked = true
+		}
+	}
+
+	distinct := make(map[string]bool)
+	allKnown := true
+
+	for i, part := range parts {
+		distinct[part.Name] = true
+
+		if part.Bars == 0 {
+			parts[i].Bars = bars[part.Name]
+		}
+
+		if parts[i].Bars == 0 {
+			allKnown = false
+		}
+
+		structure.TotalBars += parts[i].Bars
+	}
+
+	structure.DistinctParts = len(distinct)
+
+	if !allKnown {
+		structure.TotalBars = 0
+	}
+
+	return structure, nil
+}
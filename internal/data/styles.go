@@ -0,0 +1,452 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+var (
+	ErrDuplicateStyle   = errors.New("duplicate style")
+	ErrDuplicateSynonym = errors.New("duplicate synonym")
+	ErrStyleCycle       = errors.New("style cycle")
+	ErrStyleInUse       = errors.New("style in use")
+)
+
+var TuneTypes = []string{"reel", "jig", "slip_jig", "single_jig", "hornpipe", "polka", "slide", "strathspey", "march",
+	"waltz", "mazurka", "schottische", "barndance", "breakdown", "rag", "two_step", "air", "song"}
+
+var (
+	canonicalIDRX     = regexp.MustCompile(`^[a-z0-9]+(_[a-z0-9]+)*$`)
+	nonAlphanumericRX = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// Canonicalize turns a style or tune type as typed into its canonical ID form, by
+// lowercasing it and joining its words with underscores (ex: "Old-Time" becomes old_time).
+func Canonicalize(s string) string {
+	return strings.Trim(nonAlphanumericRX.ReplaceAllString(strings.ToLower(s), "_"), "_")
+}
+
+type Style struct {
+	ID        string    `json:"id"`        // Canonical ID for the style (ex: old_time)
+	CreatedAt time.Time `json:"-"`         // Timestamp for when the style is added to our database
+	Name      string    `json:"name"`      // Display name (ex: Old-time)
+	ParentID  *string   `json:"parent_id"` // ID of the broader style this one belongs to, if any
+	Synonyms  []string  `json:"synonyms"`  // Other names the style is known by, resolved to its ID on input
+	Version   int32     `json:"version"`   // The version number starts at 1 and will be incremented each time the style is updated
+}
+
+// UnmatchedStyle is a style found on a tune that is not in the taxonomy, left over from
+// before styles were managed.
+type UnmatchedStyle struct {
+	TuneID int64  `json:"tune_id"`
+	Title  string `json:"title"`
+	Style  string `json:"style"`
+}
+
+func ValidateStyle(v *validator.Validator, style *Style) {
+	v.Check(style.ID != "", "id", "must be provided")
+	v.Check(len(style.ID) <= 100, "id", "must not be more than 100 bytes long")
+	v.Check(validator.Matches(style.ID, canonicalIDRX), "id", "must be lowercase letters and digits separated by underscores")
+
+	v.Check(style.Name != "", "name", "must be provided")
+	v.Check(len(style.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	if style.ParentID != nil {
+		v.Check(*style.ParentID != style.ID, "parent_id", "must not be the style itself")
+	}
+
+	v.Check(len(style.Synonyms) <= 50, "synonyms", "must not contain more than 50 synonyms")
+	v.Check(validator.Unique(style.Synonyms), "synonyms", "must not contain duplicate values")
+
+	for _, synonym := range style.Synonyms {
+		v.Check(synonym != "", "synonyms", "must not contain empty values")
+		v.Check(len(synonym) <= 100, "synonyms", "must not contain values more than 100 bytes long")
+	}
+}
+
+type StyleModel struct {
+	DB *sql.DB
+}
+
+// writeSynonyms replaces the style's synonyms with the ones in style.Synonyms, then
+// moves any tunes still carrying one of the style's names as free text onto its ID.
+func (s *Style) writeSynonyms(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM style_synonyms WHERE style_id = $1`, s.ID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO style_synonyms (synonym, style_id)
+		SELECT unnest($1::text[]), $2`
+
+	_, err = tx.ExecContext(ctx, query, pq.Array(s.Synonyms), s.ID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "style_synonyms_pkey"`:
+			return ErrDuplicateSynonym
+		default:
+			return err
+		}
+	}
+
+	query = `
+		UPDATE tunes
+		SET styles = ARRAY(
+			SELECT CASE WHEN style::citext = ANY($1::citext[]) THEN $2 ELSE style END
+			FROM unnest(tunes.styles) WITH ORDINALITY AS s(style, n)
+			GROUP BY 1
+			ORDER BY min(n)), version = version + 1
+		WHERE EXISTS (SELECT 1 FROM unnest(tunes.styles) AS style WHERE style <> $2 AND style::citext = ANY($1::citext[]))`
+
+	names := append([]string{s.ID, s.Name}, s.Synonyms...)
+
+	_, err = tx.ExecContext(ctx, query, pq.Array(names), s.ID)
+	return err
+}
+
+// checkParent returns ErrStyleCycle if making parentID the style's parent would make
+// the style an ancestor of itself.
+func (s *Style) checkParent(ctx context.Context, tx *sql.Tx) error {
+	if s.ParentID == nil {
+		return nil
+	}
+
+	query := `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM styles WHERE id = $1
+			UNION
+			SELECT styles.id, styles.parent_id FROM styles JOIN ancestors ON styles.id = ancestors.parent_id
+		)
+		SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)`
+
+	var cycle bool
+
+	err := tx.QueryRowContext(ctx, query, *s.ParentID, s.ID).Scan(&cycle)
+	if err != nil {
+		return err
+	}
+
+	if cycle {
+		return ErrStyleCycle
+	}
+
+	return nil
+}
+
+func (m StyleModel) Insert(style *Style) error {
+	query := `
+		INSERT INTO styles (id, name, parent_id)
+		VALUES ($1, $2, $3)
+		RETURNING created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, style.ID, style.Name, style.ParentID).Scan(&style.CreatedAt, &style.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "styles_pkey"`,
+			err.Error() == `pq: duplicate key value violates unique constraint "styles_name_key"`:
+			return ErrDuplicateStyle
+		default:
+			return err
+		}
+	}
+
+	err = style.writeSynonyms(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// The columns read when selecting a style, with its synonyms gathered into an array
+const styleColumns = `styles.id, styles.created_at, styles.name, styles.parent_id, styles.version,
+			ARRAY(SELECT style_synonyms.synonym::text FROM style_synonyms
+				WHERE style_synonyms.style_id = styles.id ORDER BY style_synonyms.synonym)`
+
+func (m StyleModel) Get(id string) (*Style, error) {
+	query := `
+		SELECT ` + styleColumns + `
+		FROM styles
+		WHERE id = $1`
+
+	var style Style
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&style.ID,
+		&style.CreatedAt,
+		&style.Name,
+		&style.ParentID,
+		&style.Version,
+		pq.Array(&style.Synonyms),
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &style, nil
+}
+
+// GetAll returns the styles matching name, which is also looked for among the
+// synonyms. A non-empty parentID limits the results to that style's descendants.
+func (m StyleModel) GetAll(name, parentID string, filters Filters) ([]*Style, Metadata, error) {
+	query := fmt.Sprintf(`
+		WITH RECURSIVE descendants AS (
+			SELECT id FROM styles WHERE parent_id = $2
+			UNION
+			SELECT styles.id FROM styles JOIN descendants ON styles.parent_id = descendants.id
+		)
+		SELECT count(*) OVER(), %s
+		FROM styles
+		WHERE (to_tsvector('simple', styles.name) @@ plainto_tsquery('simple', $1) OR $1 = ''
+			OR EXISTS (SELECT 1 FROM style_synonyms WHERE style_synonyms.style_id = styles.id
+				AND to_tsvector('simple', style_synonyms.synonym) @@ plainto_tsquery('simple', $1)))
+		AND (styles.id IN (SELECT id FROM descendants) OR $2 = '')
+		ORDER BY %s %s, styles.id ASC
+		LIMIT $3 OFFSET $4`, styleColumns, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, parentID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	styles := []*Style{}
+
+	for rows.Next() {
+		var style Style
+
+		err := rows.Scan(
+			&totalRecords,
+			&style.ID,
+			&style.CreatedAt,
+			&style.Name,
+			&style.ParentID,
+			&style.Version,
+			pq.Array(&style.Synonyms),
+		)
+
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		styles = append(styles, &style)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return styles, metadata, nil
+}
+
+func (m StyleModel) Update(style *Style) error {
+	query := `
+		UPDATE styles
+		SET name = $1, parent_id = $2, version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = style.checkParent(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, query, style.Name, style.ParentID, style.ID, style.Version).Scan(&style.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "styles_name_key"`:
+			return ErrDuplicateStyle
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	err = style.writeSynonyms(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes the style and its synonyms. A style cannot be deleted while tunes
+// are tagged with it or other styles sit under it.
+func (m StyleModel) Delete(id string) error {
+	query := `
+		DELETE FROM styles
+		WHERE id = $1
+		AND NOT EXISTS (SELECT 1 FROM tunes WHERE styles @> ARRAY[$1])`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: update or delete on table "styles" violates foreign key constraint "styles_parent_id_fkey" on table "styles"`:
+			return ErrStyleInUse
+		default:
+			return err
+		}
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		if _, err := m.Get(id); err != nil {
+			return err
+		}
+		return ErrStyleInUse
+	}
+
+	return nil
+}
+
+// CountUses returns the number of tunes tagged with the style and the number of styles
+// directly under it.
+func (m StyleModel) CountUses(id string) (tunes int, children int, err error) {
+	query := `
+		SELECT (SELECT count(*) FROM tunes WHERE styles @> ARRAY[$1]),
+			(SELECT count(*) FROM styles WHERE parent_id = $1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, id).Scan(&tunes, &children)
+	return tunes, children, err
+}
+
+// Resolve maps each of the given names to the ID of the style it refers to, by ID, name
+// or synonym. Names that match no style are left out of the map.
+func (m StyleModel) Resolve(names []string) (map[string]string, error) {
+	canonical := make([]string, len(names))
+	for i, name := range names {
+		canonical[i] = Canonicalize(name)
+	}
+
+	query := `
+		SELECT names.name, coalesce(
+			(SELECT styles.id FROM styles WHERE styles.id = names.canonical OR styles.name = names.name::citext
+				ORDER BY styles.id = names.canonical DESC LIMIT 1),
+			(SELECT style_synonyms.style_id FROM style_synonyms WHERE style_synonyms.synonym = names.name::citext))
+		FROM unnest($1::text[], $2::text[]) AS names(name, canonical)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(names), pq.Array(canonical))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[string]string)
+
+	for rows.Next() {
+		var name string
+		var id sql.NullString
+
+		if err := rows.Scan(&name, &id); err != nil {
+			return nil, err
+		}
+
+		if id.Valid {
+			ids[name] = id.String
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// GetUnmatched returns the styles found on tunes that are not part of the taxonomy.
+func (m StyleModel) GetUnmatched(filters Filters) ([]*UnmatchedStyle, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), tune_id, title, style
+		FROM unmatched_tune_styles
+		ORDER BY %s %s, tune_id ASC
+		LIMIT $1 OFFSET $2`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	unmatched := []*UnmatchedStyle{}
+
+	for rows.Next() {
+		var u UnmatchedStyle
+
+		err := rows.Scan(&totalRecords, &u.TuneID, &u.Title, &u.Style)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		unmatched = append(unmatched, &u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return unmatched, metadata, nil
+}
@@ -0,0 +1,43 @@
+package data
+
+import (
+	"database/sql"
+
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+// Tempo is the range of speeds a tune is typically played at, in beats per minute.
+type Tempo struct {
+	Min      int    `json:"min"`       // Slowest typical tempo in BPM
+	Max      int    `json:"max"`       // Fastest typical tempo in BPM
+	BeatUnit string `json:"beat_unit"` // Note value counted as one beat, derived from the time signature
+}
+
+func ValidateTempo(v *validator.Validator, tempo *Tempo) {
+	v.Check(tempo.Min >= 20, "tempo", "must have a minimum of at least 20 BPM")
+	v.Check(tempo.Max <= 400, "tempo", "must have a maximum of at most 400 BPM")
+	v.Check(tempo.Min <= tempo.Max, "tempo", "must have a minimum no greater than its maximum")
+}
+
+// scanTempo sets the tune's tempo from the tempo_min and tempo_max columns, which are
+// either both NULL or both set.
+func (tune *Tune) scanTempo(tempoMin, tempoMax sql.NullInt32) {
+	tune.Tempo = nil
+
+	if tempoMin.Valid && tempoMax.Valid {
+		tune.Tempo = &Tempo{Min: int(tempoMin.Int32), Max: int(tempoMax.Int32)}
+		tune.Tempo.BeatUnit = tune.TimeSignature.BeatUnit()
+	}
+}
+
+// tempoArgs returns the tune's tempo as the tempo_min and tempo_max column values,
+// filling in the beat unit from the time signature as it goes.
+func (tune *Tune) tempoArgs() (tempoMin, tempoMax *int) {
+	if tune.Tempo == nil {
+		return nil, nil
+	}
+
+	tune.Tempo.BeatUnit = tune.TimeSignature.BeatUnit()
+
+	return &tune.Tempo.Min, &tune.Tempo.Max
+}
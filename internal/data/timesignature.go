@@ -1,37 +1,181 @@
 package data
 
 import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"strconv"
 	"strings"
 )
 
 var ErrInvalidTimeSignatureFormat = errors.New("invalid time signature format")
 
-type TimeSignature string
+var MeterClasses = []string{"duple", "triple", "quadruple", "compound duple", "compound triple", "compound quadruple", "irregular"}
 
-func (ts *TimeSignature) UnmarshalJSON(jsonValue []byte) error {
-	unquotedJSONValue, err := strconv.Unquote(string(jsonValue))
+type TimeSignature struct {
+	Beats int // Number of beats in a bar, the upper number
+	Unit  int // Note value of each beat, the lower number
+}
+
+// ParseTimeSignature accepts a time signature written as "<beats>/<unit>" where beats
+// is between 1 and 99 and unit is a power of two no larger than 64.
+func ParseTimeSignature(s string) (TimeSignature, error) {
+	ts, err := splitTimeSignature(s)
 	if err != nil {
-		return ErrInvalidTimeSignatureFormat
+		return TimeSignature{}, err
 	}
 
-	parts := strings.Split(unquotedJSONValue, "/")
+	if !ts.Valid() {
+		return TimeSignature{}, ErrInvalidTimeSignatureFormat
+	}
+
+	return ts, nil
+}
+
+func splitTimeSignature(s string) (TimeSignature, error) {
+	parts := strings.Split(s, "/")
 
 	if len(parts) != 2 {
-		return ErrInvalidTimeSignatureFormat
+		return TimeSignature{}, ErrInvalidTimeSignatureFormat
+	}
+
+	beats, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return TimeSignature{}, ErrInvalidTimeSignatureFormat
 	}
 
-	_, err = strconv.Atoi(parts[0])
+	unit, err := strconv.Atoi(parts[1])
 	if err != nil {
-		return ErrInvalidTimeSignatureFormat
+		return TimeSignature{}, ErrInvalidTimeSignatureFormat
+	}
+
+	return TimeSignature{Beats: beats, Unit: unit}, nil
+}
+
+func (ts TimeSignature) Valid() bool {
+	return ts.Beats >= 1 && ts.Beats <= 99 && ts.Unit >= 1 && ts.Unit <= 64 && ts.Unit&(ts.Unit-1) == 0
+}
+
+func (ts TimeSignature) String() string {
+	return fmt.Sprintf("%d/%d", ts.Beats, ts.Unit)
+}
+
+// MeterClass groups the time signature by how its beats are felt (ex: "compound duple"
+// for 6/8, "triple" for 3/4). Anything other than 2, 3, 4, 6, 9 or 12 beats is irregular.
+// The tunes.meter_class column computes the same classification in SQL.
+func (ts TimeSignature) MeterClass() string {
+	switch ts.Beats {
+	case 2:
+		return "duple"
+	case 3:
+		return "triple"
+	case 4:
+		return "quadruple"
+	case 6:
+		return "compound duple"
+	case 9:
+		return "compound triple"
+	case 12:
+		return "compound quadruple"
+	}
+
+	return "irregular"
+}
+
+// Kind returns whether the meter is simple, compound or irregular.
+func (ts TimeSignature) Kind() string {
+	switch class := ts.MeterClass(); {
+	case class == "irregular":
+		return "irregular"
+	case strings.HasPrefix(class, "compound"):
+		return "compound"
+	}
+
+	return "simple"
+}
+
+// noteNames names the note values a time signature's unit can stand for.
+var noteNames = map[int]string{
+	1:  "whole",
+	2:  "half",
+	4:  "quarter",
+	8:  "eighth",
+	16: "sixteenth",
+	32: "thirty-second",
+	64: "sixty-fourth",
+}
+
+// BeatUnit returns the note value felt as one beat, which tempos are counted in. In
+// compound meters three units make up a beat, so 6/8 is counted in dotted quarters.
+func (ts TimeSignature) BeatUnit() string {
+	if ts.Kind() == "compound" && ts.Unit > 1 {
+		return "dotted " + noteNames[ts.Unit/2]
+	}
+
+	return noteNames[ts.Unit]
+}
+
+func (ts TimeSignature) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(ts.String())), nil
+}
+
+// UnmarshalJSON accepts either the "6/8" string form or the {"beats":6,"unit":8} object form.
+func (ts *TimeSignature) UnmarshalJSON(jsonValue []byte) error {
+	var timeSignature TimeSignature
+
+	if unquotedJSONValue, err := strconv.Unquote(string(jsonValue)); err == nil {
+		timeSignature, err = ParseTimeSignature(unquotedJSONValue)
+		if err != nil {
+			return err
+		}
+	} else {
+		var object struct {
+			Beats int `json:"beats"`
+			Unit  int `json:"unit"`
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(jsonValue))
+		dec.DisallowUnknownFields()
+
+		if err := dec.Decode(&object); err != nil {
+			return ErrInvalidTimeSignatureFormat
+		}
+
+		timeSignature = TimeSignature{Beats: object.Beats, Unit: object.Unit}
+		if !timeSignature.Valid() {
+			return ErrInvalidTimeSignatureFormat
+		}
+	}
+
+	*ts = timeSignature
+	return nil
+}
+
+func (ts TimeSignature) Value() (driver.Value, error) {
+	return ts.String(), nil
+}
+
+// Scan is deliberately lenient so that rows stored before time signatures were
+// validated can still be read and then corrected through an update.
+func (ts *TimeSignature) Scan(src any) error {
+	var s string
+
+	switch src := src.(type) {
+	case string:
+		s = src
+	case []byte:
+		s = string(src)
+	default:
+		return fmt.Errorf("cannot scan %T into TimeSignature", src)
 	}
 
-	_, err = strconv.Atoi(parts[1])
+	timeSignature, err := splitTimeSignature(s)
 	if err != nil {
-		return ErrInvalidTimeSignatureFormat
+		return err
 	}
 
-	*ts = TimeSignature(unquotedJSONValue)
+	*ts = timeSignature
 	return nil
 }
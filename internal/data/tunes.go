@@ -3,42 +3,199 @@ package data
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
+	"jambuster.njvanhaute.com/internal/abc"
+	"jambuster.njvanhaute.com/internal/storage"
 	"jambuster.njvanhaute.com/internal/validator"
 )
 
 type Tune struct {
-	ID            int64         `json:"id"`             // Unique integer ID for the tune
-	CreatedAt     time.Time     `json:"-"`              // Timestamp for when the tune is added to our database
-	Title         string        `json:"title"`          // Tune title
-	Styles        []string      `json:"styles"`         // Slice of styles for the tune (Bluegrass, old time, Irish, etc.)
-	Keys          []Key         `json:"keys"`           // Slice of keys for the tune (ex: A major, G minor)
-	TimeSignature TimeSignature `json:"time_signature"` // Tune time signature
-	Structure     string        `json:"structure"`      // Tune structure (ex: AABA)
-	HasLyrics     bool          `json:"has_lyrics"`     // Whether or not the tune has lyrics
-	Version       int32         `json:"version"`        // The version number starts at 1 and will be incremented each time the tune info is updated
+	ID              int64            `json:"id"`                         // Unique integer ID for the tune
+	CreatedAt       time.Time        `json:"-"`                          // Timestamp for when the tune is added to our database
+	Title           string           `json:"title"`                      // Tune title
+	Aliases         []string         `json:"aliases"`                    // Alternate titles the tune is also known by
+	MatchedTitle    *string          `json:"matched_title,omitempty"`    // The title or alias that matched a title search
+	Relevance       *float64         `json:"relevance,omitempty"`        // How closely the title or an alias matched a title search, higher being closer
+	Composers       []Composer       `json:"composers"`                  // Composers credited with the tune, none for a traditional tune
+	Sources         []Source         `json:"sources"`                    // Players, recordings, collections or regions the tune was learned from
+	Traditional     bool             `json:"traditional"`                // Whether the tune is traditional, that is it has no known composer
+	Sets            []SetMembership  `json:"sets,omitempty"`             // Sets the tune is played in, only reported when showing a single tune
+	Styles          []string         `json:"styles"`                     // Slice of style IDs for the tune (bluegrass, old_time, irish, etc.)
+	TuneType        *string          `json:"tune_type"`                  // Kind of tune (reel, jig, waltz, etc.), null if not known
+	Keys            []Key            `json:"keys"`                       // Slice of keys for the tune (ex: A major, G minor)
+	TimeSignature   TimeSignature    `json:"time_signature"`             // Tune time signature
+	Tempo           *Tempo           `json:"tempo"`                      // Typical tempo range, null if unknown
+	Tunings         []Tuning         `json:"tunings"`                    // Instrument tunings the tune is played in (ex: AEAE on the fiddle)
+	Attachments     []Attachment     `json:"attachments"`                // Sheet music, tabs and charts uploaded for the tune, without their contents
+	Structure       string           `json:"structure"`                  // Tune structure (ex: AABA)
+	ParsedStructure *ParsedStructure `json:"parsed_structure,omitempty"` // Parts, bar counts and crookedness derived from the structure
+	HasLyrics       bool             `json:"has_lyrics"`                 // Whether or not the tune has lyrics, derived from the lyrics resource
+	LyricsSnippet   *string          `json:"lyrics_snippet,omitempty"`   // Highlighted line of the lyrics matching a lyrics search
+	GroupComfort    *string          `json:"group_comfort,omitempty"`    // Weakest proficiency among the players a search was matched against
+	Players         []TunePlayer     `json:"players,omitempty"`          // How each of the players a search was matched against knows the tune
+	ABC             *string          `json:"abc,omitempty"`              // Body of the tune in ABC notation, everything following the K: field
+	Version         int32            `json:"version"`                    // The version number starts at 1 and will be incremented each time the tune info is updated
 }
 
 type TuneModel struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Storage storage.Storage
+}
+
+// parseStructure fills in the tune's ParsedStructure and returns the part_count and
+// crooked column values derived from it, which are NULL and false when the structure
+// cannot be parsed.
+func (tune *Tune) parseStructure() (*int, bool) {
+	tune.ParsedStructure, _ = ParseStructure(tune.Structure)
+	if tune.ParsedStructure == nil {
+		return nil, false
+	}
+
+	return &tune.ParsedStructure.DistinctParts, tune.ParsedStructure.Crooked
+}
+
+// The composers and sources linked to a tune, selected as JSON arrays alongside the
+// tune's own columns and decoded by scanCredits
+const tuneCreditsColumns = `
+			(SELECT coalesce(json_agg(json_build_object('id', composers.id, 'name', composers.name,
+				'version', composers.version) ORDER BY composers.name), '[]')
+			FROM composers JOIN tune_composers ON tune_composers.composer_id = composers.id
+			WHERE tune_composers.tune_id = tunes.id),
+			(SELECT coalesce(json_agg(json_build_object('id', sources.id, 'name', sources.name, 'kind', sources.kind,
+				'description', sources.description, 'version', sources.version) ORDER BY sources.name), '[]')
+			FROM sources JOIN tune_sources ON tune_sources.source_id = sources.id
+			WHERE tune_sources.tune_id = tunes.id)`
+
+func (tune *Tune) scanCredits(composers, sources []byte) error {
+	err := json.Unmarshal(composers, &tune.Composers)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(sources, &tune.Sources)
+	if err != nil {
+		return err
+	}
+
+	tune.Traditional = len(tune.Composers) == 0
+
+	return nil
+}
+
+// writeCredits replaces the tune's links to composers and sources with the ones in
+// tune.Composers and tune.Sources.
+func (tune *Tune) writeCredits(ctx context.Context, tx *sql.Tx) error {
+	composerIDs := []int64{}
+	for _, composer := range tune.Composers {
+		composerIDs = append(composerIDs, composer.ID)
+	}
+
+	sourceIDs := []int64{}
+	for _, source := range tune.Sources {
+		sourceIDs = append(sourceIDs, source.ID)
+	}
+
+	queries := []struct {
+		query string
+		args  []any
+	}{
+		{`DELETE FROM tune_composers WHERE tune_id = $1`, []any{tune.ID}},
+		{`DELETE FROM tune_sources WHERE tune_id = $1`, []any{tune.ID}},
+		{`INSERT INTO tune_composers (tune_id, composer_id) SELECT $1, unnest($2::bigint[])`, []any{tune.ID, pq.Array(composerIDs)}},
+		{`INSERT INTO tune_sources (tune_id, source_id) SELECT $1, unnest($2::bigint[])`, []any{tune.ID, pq.Array(sourceIDs)}},
+	}
+
+	for _, q := range queries {
+		_, err := tx.ExecContext(ctx, q.query, q.args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	tune.Traditional = len(tune.Composers) == 0
+
+	return nil
 }
 
 func (t TuneModel) Insert(tune *Tune) error {
+	return t.InsertWithLyrics(tune, nil)
+}
+
+// InsertWithLyrics adds the tune together with its lyrics, when there are any, in one
+// transaction so that the tune is not kept without them if they fail.
+func (t TuneModel) InsertWithLyrics(tune *Tune, lyrics *Lyrics) error {
 	query := `
-		INSERT INTO tunes (title, styles, keys, time_signature, structure, has_lyrics)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO tunes (title, styles, tune_type, keys, time_signature, structure, part_count, crooked, abc, tempo_min, tempo_max)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 		RETURNING id, created_at, version`
 
-	args := []any{tune.Title, pq.Array(tune.Styles), pq.Array(tune.Keys), tune.TimeSignature, tune.Structure, tune.HasLyrics}
+	partCount, crooked := tune.parseStructure()
+	tempoMin, tempoMax := tune.tempoArgs()
+
+	args := []any{tune.Title, pq.Array(tune.Styles), tune.TuneType, pq.Array(tune.Keys), tune.TimeSignature, tune.Structure, partCount,
+		crooked, tune.ABC, tempoMin, tempoMax}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return t.DB.QueryRowContext(ctx, query, args...).Scan(&tune.ID, &tune.CreatedAt, &tune.Version)
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&tune.ID, &tune.CreatedAt, &tune.Version)
+	if err != nil {
+		return err
+	}
+
+	err = tune.writeCredits(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	err = tune.writeTunings(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	if lyrics != nil {
+		lyrics.TuneID = tune.ID
+
+		err = lyrics.insert(ctx, tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	tune.HasLyrics = lyrics != nil
+
+	// Aliases are added through the aliases endpoints once the tune exists
+	tune.Aliases = []string{}
+
+	if tune.Composers == nil {
+		tune.Composers = []Composer{}
+	}
+
+	if tune.Sources == nil {
+		tune.Sources = []Source{}
+	}
+
+	if tune.Tunings == nil {
+		tune.Tunings = []Tuning{}
+	}
+
+	// Attachments are uploaded through the attachments endpoints once the tune exists
+	tune.Attachments = []Attachment{}
+
+	return tx.Commit()
 }
 
 func (t TuneModel) Get(id int64) (*Tune, error) {
@@ -47,12 +204,17 @@ func (t TuneModel) Get(id int64) (*Tune, error) {
 	}
 
 	query := `
-		SELECT id, created_at, title, styles, keys, time_signature, structure, has_lyrics, version
+		SELECT id, created_at, title, styles, tune_type, keys, time_signature, tempo_min, tempo_max, structure,
+			EXISTS (SELECT 1 FROM lyrics WHERE lyrics.tune_id = tunes.id), abc, version,
+			ARRAY(SELECT tune_aliases.title::text FROM tune_aliases WHERE tune_aliases.tune_id = tunes.id ORDER BY tune_aliases.id),` +
+		tuneCreditsColumns + `,` + tuneTuningsColumn + `,` + tuneAttachmentsColumn + `
 		FROM tunes
 		WHERE id = $1`
 
 	var tune Tune
 	var keyStrings []string
+	var composers, sources, tunings, attachments []byte
+	var tempoMin, tempoMax sql.NullInt32
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -62,11 +224,20 @@ func (t TuneModel) Get(id int64) (*Tune, error) {
 		&tune.CreatedAt,
 		&tune.Title,
 		pq.Array(&tune.Styles),
+		&tune.TuneType,
 		pq.Array(&keyStrings),
 		&tune.TimeSignature,
+		&tempoMin,
+		&tempoMax,
 		&tune.Structure,
 		&tune.HasLyrics,
+		&tune.ABC,
 		&tune.Version,
+		pq.Array(&tune.Aliases),
+		&composers,
+		&sources,
+		&tunings,
+		&attachments,
 	)
 
 	if err != nil {
@@ -78,35 +249,251 @@ func (t TuneModel) Get(id int64) (*Tune, error) {
 		}
 	}
 
+	err = tune.scanCredits(composers, sources)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tune.scanTunings(tunings)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tune.scanAttachments(attachments)
+	if err != nil {
+		return nil, err
+	}
+
 	for _, keyString := range keyStrings {
-		tune.Keys = append(tune.Keys, Key(keyString))
+		key, err := ParseKey(keyString)
+		if err != nil {
+			return nil, err
+		}
+		tune.Keys = append(tune.Keys, key)
 	}
 
+	tune.parseStructure()
+	tune.scanTempo(tempoMin, tempoMax)
+
 	return &tune, nil
 }
 
-func (t TuneModel) GetAll(title string, styles []string, keys []string, timeSignature string, structure string, hasLyrics *bool, filters Filters) ([]*Tune, Metadata, error) {
+// TuneFilters holds the search criteria for TuneModel.GetAll. Zero values leave the
+// corresponding filter disabled.
+type TuneFilters struct {
+	Title         string   // Matches the tune's title or any of its aliases
+	Styles        []string // Style IDs, each matching tunes tagged with the style or any style under it
+	TuneType      string
+	Keys          []Key
+	KeySignature  *KeySignature // Matches tunes in any key written with this signature
+	Enharmonic    bool          // Also match keys and signatures that sound the same but are spelled differently
+	TimeSignature string
+	MeterClass    string
+	Structure     string
+	PartCount     int // Number of distinct parts
+	Crooked       *bool
+	HasLyrics     *bool
+	Lyrics        string // Full-text search of the lyrics
+	ComposerID    int64
+	SourceID      int64
+	Traditional   *bool // Whether the tune has no credited composer
+	UserID        int64 // The user whose repertoire the InRepertoire and Proficiency filters look at
+	InRepertoire  *bool
+	Proficiency   string
+	PlayerIDs     []int64 // Users who must all have the tune in their repertoire
+	TempoMin      int     // Matches tunes whose tempo range reaches at least this BPM
+	TempoMax      int     // Matches tunes whose tempo range reaches at most this BPM
+	Instrument    string  // Matches tunes with a tuning recorded for this instrument
+	TuningIDs     []int64 // Matches tunes played in any of these tunings
+}
+
+// keyArgs returns the key filters as SQL arguments: the keys a tune must all contain,
+// the "|" separated spellings of which a tune must contain at least one per element,
+// and the keys of which a tune must contain at least one.
+func (tf TuneFilters) keyArgs() (keys []string, spellings []string, signatureKeys []string) {
+	keys, spellings, signatureKeys = []string{}, []string{}, []string{}
+
+	for _, key := range tf.Keys {
+		if !tf.Enharmonic {
+			keys = append(keys, key.String())
+			continue
+		}
+
+		var names []string
+		for _, enharmonic := range key.Enharmonics() {
+			names = append(names, enharmonic.String())
+		}
+		spellings = append(spellings, strings.Join(names, "|"))
+	}
+
+	// Keys are stored in their canonical spelling, so a signature of 7 sharps finds the
+	// tunes stored in the 5 flat keys that sound the same
+	if tf.KeySignature != nil {
+		for _, key := range KeysWithSignature(*tf.KeySignature, tf.Enharmonic) {
+			if name := key.Canonical().String(); !slices.Contains(signatureKeys, name) {
+				signatureKeys = append(signatureKeys, name)
+			}
+		}
+	}
+
+	return keys, spellings, signatureKeys
+}
+
+func (t TuneModel) GetAll(tf TuneFilters, filters Filters) ([]*Tune, Metadata, error) {
+	sortColumn, sortDirection := filters.sortColumn(), filters.sortDirection()
+
+	// Relevance always ranks the closest matches first
+	if sortColumn == "relevance" {
+		sortDirection = "DESC"
+	}
+
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), id, created_at, title, styles, keys, time_signature, structure, has_lyrics, version
+		WITH RECURSIVE wanted_styles AS (
+			SELECT wanted, wanted AS id FROM unnest($2::text[]) AS wanted
+			UNION
+			SELECT wanted_styles.wanted, styles.id FROM styles JOIN wanted_styles ON styles.parent_id = wanted_styles.id
+		)
+		SELECT count(*) OVER(), tunes.id, tunes.created_at, tunes.title, tunes.styles, tunes.tune_type, tunes.keys, tunes.time_signature,
+			tunes.tempo_min, tunes.tempo_max, tunes.structure, lyrics.tune_id IS NOT NULL AS has_lyrics, tunes.version,
+			ARRAY(SELECT tune_aliases.title::text FROM tune_aliases WHERE tune_aliases.tune_id = tunes.id ORDER BY tune_aliases.id),
+			CASE
+				WHEN $1 = '' THEN NULL
+				WHEN NOT $28 AND to_tsvector('simple_unaccent', tunes.title) @@ plainto_tsquery('simple_unaccent', $1) THEN tunes.title
+				WHEN NOT $28 THEN (SELECT tune_aliases.title::text FROM tune_aliases WHERE tune_aliases.tune_id = tunes.id
+					AND to_tsvector('simple_unaccent', tune_aliases.title) @@ plainto_tsquery('simple_unaccent', $1) ORDER BY tune_aliases.id LIMIT 1)
+				WHEN fold_title($1) <%% fold_title(tunes.title) THEN tunes.title
+				ELSE (SELECT tune_aliases.title::text FROM tune_aliases WHERE tune_aliases.tune_id = tunes.id
+					AND fold_title($1) <%% fold_title(tune_aliases.title)
+					ORDER BY word_similarity(fold_title($1), fold_title(tune_aliases.title)) DESC, tune_aliases.id LIMIT 1)
+			END,
+			CASE WHEN $1 = '' THEN NULL ELSE (
+				SELECT max(ts_rank(to_tsvector('simple_unaccent', candidate), plainto_tsquery('simple_unaccent', $1))
+					+ similarity(fold_title(candidate), fold_title($1)))
+				FROM (SELECT tunes.title UNION ALL SELECT tune_aliases.title::text FROM tune_aliases WHERE tune_aliases.tune_id = tunes.id)
+					AS titles (candidate)
+			) END AS relevance,
+			CASE WHEN $12 = '' THEN NULL ELSE coalesce(
+				(SELECT ts_headline('simple', line, plainto_tsquery('simple', $12))
+				FROM unnest(string_to_array(lyrics.text, E'\n')) AS line
+				WHERE to_tsvector('simple', line) @@ plainto_tsquery('simple', $12)
+				LIMIT 1),
+				ts_headline('simple', lyrics.text, plainto_tsquery('simple', $12), 'MaxFragments=1, MaxWords=15, MinWords=5')
+			) END,
+			(SELECT min(array_position($20::text[], repertoire.proficiency)) FROM repertoire
+			WHERE repertoire.tune_id = tunes.id AND repertoire.user_id = ANY($19)) AS comfort,
+			(SELECT json_agg(json_build_object('user_id', users.id, 'name', users.name,
+				'proficiency', repertoire.proficiency, 'preferred_key', repertoire.preferred_key,
+				'instrument', repertoire.instrument) ORDER BY users.name, users.id)
+			FROM repertoire JOIN users ON users.id = repertoire.user_id
+			WHERE repertoire.tune_id = tunes.id AND repertoire.user_id = ANY($19)),%s,%s,%s
 		FROM tunes
-		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-		AND (styles @> $2 OR $2 = '{}')
+		LEFT JOIN lyrics ON lyrics.tune_id = tunes.id
+		WHERE ($1 = ''
+			OR NOT $28 AND to_tsvector('simple_unaccent', tunes.title) @@ plainto_tsquery('simple_unaccent', $1)
+			OR NOT $28 AND EXISTS (SELECT 1 FROM tune_aliases WHERE tune_aliases.tune_id = tunes.id
+				AND to_tsvector('simple_unaccent', tune_aliases.title) @@ plainto_tsquery('simple_unaccent', $1))
+			OR $28 AND fold_title($1) <%% fold_title(tunes.title)
+			OR $28 AND EXISTS (SELECT 1 FROM tune_aliases WHERE tune_aliases.tune_id = tunes.id
+				AND fold_title($1) <%% fold_title(tune_aliases.title)))
+		AND NOT EXISTS (SELECT 1 FROM unnest($2::text[]) AS style_filter
+			WHERE NOT tunes.styles && ARRAY(SELECT wanted_styles.id FROM wanted_styles WHERE wanted_styles.wanted = style_filter))
+		AND (tune_type = $23 OR $23 = '')
+		AND (EXISTS (SELECT 1 FROM tune_tunings WHERE tune_tunings.tune_id = tunes.id
+			AND (tune_tunings.instrument = $24 OR $24 = '') AND (tune_tunings.tuning_id = ANY($25) OR $25 = '{}'))
+			OR ($24 = '' AND $25 = '{}'))
 		AND (keys @> $3 OR $3 = '{}')
-		AND (time_signature = $4 OR $4 = '')
-		AND (structure = $5 OR $5 = '')
-		AND (has_lyrics = $6 OR $6 IS NULL)
-		ORDER BY %s %s, id ASC
-		LIMIT $7 OFFSET $8`, filters.sortColumn(), filters.sortDirection())
+		AND NOT EXISTS (SELECT 1 FROM unnest($4::text[]) AS spellings WHERE NOT keys && string_to_array(spellings, '|'))
+		AND (keys && $5 OR $5 = '{}')
+		AND (time_signature = $6 OR $6 = '')
+		AND (meter_class = $7 OR $7 = '')
+		AND (structure = $8 OR $8 = '')
+		AND (part_count = $9 OR $9 = 0)
+		AND (crooked = $10 OR $10 IS NULL)
+		AND ((lyrics.tune_id IS NOT NULL) = $11 OR $11 IS NULL)
+		AND (to_tsvector('simple', lyrics.text) @@ plainto_tsquery('simple', $12) OR $12 = '')
+		AND (EXISTS (SELECT 1 FROM tune_composers WHERE tune_composers.tune_id = tunes.id AND composer_id = $13) OR $13 = 0)
+		AND (EXISTS (SELECT 1 FROM tune_sources WHERE tune_sources.tune_id = tunes.id AND source_id = $14) OR $14 = 0)
+		AND (NOT EXISTS (SELECT 1 FROM tune_composers WHERE tune_composers.tune_id = tunes.id) = $15 OR $15 IS NULL)
+		AND (EXISTS (SELECT 1 FROM repertoire WHERE repertoire.tune_id = tunes.id AND user_id = $16) = $17 OR $17 IS NULL)
+		AND (EXISTS (SELECT 1 FROM repertoire WHERE repertoire.tune_id = tunes.id AND user_id = $16 AND proficiency = $18) OR $18 = '')
+		AND NOT EXISTS (SELECT 1 FROM unnest($19::bigint[]) AS player_id
+			WHERE NOT EXISTS (SELECT 1 FROM repertoire WHERE repertoire.tune_id = tunes.id AND user_id = player_id))
+		AND (tempo_max >= $21 OR $21 = 0)
+		AND (tempo_min <= $22 OR $22 = 0)
+		ORDER BY %s %s NULLS LAST, tunes.id ASC
+		LIMIT $26 OFFSET $27`, tuneCreditsColumns, tuneTuningsColumn, tuneAttachmentsColumn, sortColumn, sortDirection)
+
+	keys, spellings, signatureKeys := tf.keyArgs()
+
+	if tf.Styles == nil {
+		tf.Styles = []string{}
+	}
+
+	if tf.PlayerIDs == nil {
+		tf.PlayerIDs = []int64{}
+	}
+
+	if tf.TuningIDs == nil {
+		tf.TuningIDs = []int64{}
+	}
 
+	// Titles are matched on their words first, and only when none of the tunes passing
+	// the other filters has them all are they matched by trigrams to make up for typos
+	// (ex: "Solders Joy")
+	fuzzy := false
+
+	args := []any{tf.Title, pq.Array(tf.Styles), pq.Array(keys), pq.Array(spellings), pq.Array(signatureKeys),
+		tf.TimeSignature, tf.MeterClass, tf.Structure, tf.PartCount, tf.Crooked, tf.HasLyrics, tf.Lyrics,
+		tf.ComposerID, tf.SourceID, tf.Traditional, tf.UserID, tf.InRepertoire, tf.Proficiency,
+		pq.Array(tf.PlayerIDs), pq.Array(ProficiencyLevels), tf.TempoMin, tf.TempoMax, tf.TuneType,
+		tf.Instrument, pq.Array(tf.TuningIDs), filters.limit(), filters.offset(), fuzzy}
+
+	tunes, totalRecords, err := t.queryTunes(query, args)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	if len(tunes) == 0 && tf.Title != "" {
+		fuzzy = true
+
+		// An empty page past the first may only be past the last word match, so the
+		// first page is checked for one before falling back
+		if filters.Page > 1 {
+			firstPage := slices.Clone(args)
+			firstPage[len(firstPage)-3], firstPage[len(firstPage)-2] = 1, 0
+
+			matches, _, err := t.queryTunes(query, firstPage)
+			if err != nil {
+				return nil, Metadata{}, err
+			}
+			fuzzy = len(matches) == 0
+		}
+
+		if fuzzy {
+			args[len(args)-1] = fuzzy
+
+			tunes, totalRecords, err = t.queryTunes(query, args)
+			if err != nil {
+				return nil, Metadata{}, err
+			}
+		}
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	metadata.FuzzyTitleMatch = fuzzy
+
+	return tunes, metadata, nil
+}
+
+// queryTunes runs GetAll's query, returning the page of tunes and the total number of
+// tunes matching the filters.
+func (t TuneModel) queryTunes(query string, args []any) ([]*Tune, int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{title, pq.Array(styles), pq.Array(keys), timeSignature, structure, hasLyrics,
-		filters.limit(), filters.offset()}
-
 	rows, err := t.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, Metadata{}, err
+		return nil, 0, err
 	}
 
 	defer rows.Close()
@@ -117,6 +504,9 @@ func (t TuneModel) GetAll(title string, styles []string, keys []string, timeSign
 	for rows.Next() {
 		var tune Tune
 		var keyStrings []string
+		var composers, sources, tunings, attachments, players []byte
+		var comfort sql.NullInt64
+		var tempoMin, tempoMax sql.NullInt32
 
 		err := rows.Scan(
 			&totalRecords,
@@ -124,47 +514,100 @@ func (t TuneModel) GetAll(title string, styles []string, keys []string, timeSign
 			&tune.CreatedAt,
 			&tune.Title,
 			pq.Array(&tune.Styles),
+			&tune.TuneType,
 			pq.Array(&keyStrings),
 			&tune.TimeSignature,
+			&tempoMin,
+			&tempoMax,
 			&tune.Structure,
 			&tune.HasLyrics,
 			&tune.Version,
+			pq.Array(&tune.Aliases),
+			&tune.MatchedTitle,
+			&tune.Relevance,
+			&tune.LyricsSnippet,
+			&comfort,
+			&players,
+			&composers,
+			&sources,
+			&tunings,
+			&attachments,
 		)
 
 		if err != nil {
-			return nil, Metadata{}, err
+			return nil, 0, err
+		}
+
+		if comfort.Valid {
+			tune.GroupComfort = &ProficiencyLevels[comfort.Int64-1]
+		}
+
+		if players != nil {
+			err = json.Unmarshal(players, &tune.Players)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+
+		err = tune.scanCredits(composers, sources)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		err = tune.scanTunings(tunings)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		err = tune.scanAttachments(attachments)
+		if err != nil {
+			return nil, 0, err
 		}
 
 		for _, keyString := range keyStrings {
-			tune.Keys = append(tune.Keys, Key(keyString))
+			key, err := ParseKey(keyString)
+			if err != nil {
+				return nil, 0, err
+			}
+			tune.Keys = append(tune.Keys, key)
 		}
 
+		tune.parseStructure()
+		tune.scanTempo(tempoMin, tempoMax)
+
 		tunes = append(tunes, &tune)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, Metadata{}, err
+		return nil, 0, err
 	}
 
-	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
-
-	return tunes, metadata, nil
+	return tunes, totalRecords, nil
 }
 
 func (t TuneModel) Update(tune *Tune) error {
 	query := `
 		UPDATE tunes
-		SET title = $1, styles = $2, keys = $3, time_signature = $4, structure = $5, has_lyrics = $6, version = version + 1
-		WHERE id = $7 AND version = $8
+		SET title = $1, styles = $2, tune_type = $3, keys = $4, time_signature = $5, structure = $6, part_count = $7,
+			crooked = $8, abc = $9, tempo_min = $10, tempo_max = $11, version = version + 1
+		WHERE id = $12 AND version = $13
 		RETURNING version`
 
+	partCount, crooked := tune.parseStructure()
+	tempoMin, tempoMax := tune.tempoArgs()
+
 	args := []any{
 		tune.Title,
 		pq.Array(tune.Styles),
+		tune.TuneType,
 		pq.Array(tune.Keys),
 		tune.TimeSignature,
 		tune.Structure,
-		tune.HasLyrics,
+		partCount,
+		crooked,
+		tune.ABC,
+		tempoMin,
+		tempoMax,
 		tune.ID,
 		tune.Version,
 	}
@@ -172,7 +615,13 @@ func (t TuneModel) Update(tune *Tune) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := t.DB.QueryRowContext(ctx, query, args...).Scan(&tune.Version)
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&tune.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -182,36 +631,93 @@ func (t TuneModel) Update(tune *Tune) error {
 		}
 	}
 
-	return nil
+	err = tune.writeCredits(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	err = tune.writeTunings(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
+// Delete removes the tune along with everything recorded against it, then removes
+// the files of its recordings and attachments from storage. If any file cannot be
+// removed the error wraps ErrStorageCleanup.
 func (t TuneModel) Delete(id int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
-	query := `
-		DELETE FROM tunes
-		WHERE id = $1`
-
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := t.DB.ExecContext(ctx, query, id)
+	tx, err := t.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	// Locking the tune first waits out any upload adding a file to it and stops new
+	// ones, so the keys collected below cover every file the tune has
+	var tuneID int64
 
-	rowsAffected, err := result.RowsAffected()
+	err = tx.QueryRowContext(ctx, `SELECT id FROM tunes WHERE id = $1 FOR UPDATE`, id).Scan(&tuneID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	query := `
+		WITH deleted_recordings AS (DELETE FROM recordings WHERE tune_id = $1 RETURNING storage_key),
+		deleted_attachments AS (DELETE FROM attachments WHERE tune_id = $1 RETURNING storage_key)
+		SELECT storage_key FROM deleted_recordings
+		UNION ALL
+		SELECT storage_key FROM deleted_attachments`
+
+	rows, err := tx.QueryContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+	keys := []string{}
+
+	for rows.Next() {
+		var key string
+
+		err := rows.Scan(&key)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+
+		keys = append(keys, key)
 	}
 
-	return nil
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM tunes WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	return removeFiles(t.Storage, keys)
 }
 
 func ValidateTune(v *validator.Validator, tune *Tune) {
@@ -223,15 +729,37 @@ func ValidateTune(v *validator.Validator, tune *Tune) {
 	v.Check(len(tune.Styles) <= 5, "styles", "must not contain more than 5 styles")
 	v.Check(validator.Unique(tune.Styles), "styles", "must not contain duplicate values")
 
+	if tune.TuneType != nil {
+		v.Check(validator.PermittedValue(*tune.TuneType, TuneTypes...), "tune_type", "must be one of "+strings.Join(TuneTypes, ", "))
+	}
+
 	v.Check(tune.Keys != nil, "keys", "must be provided")
 	v.Check(len(tune.Keys) >= 1, "keys", "must contain at least 1 key")
 	v.Check(len(tune.Keys) <= 10, "keys", "must not contain more than 10 keys")
 	v.Check(validator.Unique(tune.Keys), "keys", "must not contain duplicate values")
 
-	v.Check(tune.TimeSignature != "", "time_signature", "must be provided")
-	v.Check(len(tune.TimeSignature) >= 3, "time_signature", "must be at least 3 characters long")
-	v.Check(len(tune.TimeSignature) <= 5, "time_signature", "must not be more than 5 characters long")
+	v.Check(tune.TimeSignature != TimeSignature{}, "time_signature", "must be provided")
+	v.Check(tune.TimeSignature.Beats >= 1, "time_signature", "must have at least 1 beat")
+	v.Check(tune.TimeSignature.Beats <= 99, "time_signature", "must not have more than 99 beats")
+	v.Check(tune.TimeSignature.Valid(), "time_signature", "must have a beat unit that is a power of two no larger than 64")
+
+	if tune.Tempo != nil {
+		ValidateTempo(v, tune.Tempo)
+	}
+
+	v.Check(len(tune.Tunings) <= 20, "tunings", "must not contain more than 20 tunings")
 
 	v.Check(tune.Structure != "", "structure", "must be provided")
 	v.Check(len(tune.Structure) >= 1, "structure", "must be at least 1 character long")
+
+	_, err := ParseStructure(tune.Structure)
+	v.Check(err == nil, "structure", "must be a sequence of part letters with optional bar counts, such as AABB or A(8)A(8)B(10)B(10)")
+
+	if tune.ABC != nil {
+		v.Check(len(*tune.ABC) <= 100_000, "abc", "must not be more than 100000 bytes long")
+
+		if err := abc.ValidateBody(*tune.ABC); err != nil {
+			v.AddError("abc", "must be well-formed ABC notation ("+err.Error()+")")
+		}
+	}
 }
@@ -0,0 +1,329 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"jambuster.njvanhaute.com/internal/validator"
+)
+
+var (
+	ErrDuplicateTuning = errors.New("duplicate tuning")
+	ErrTuningInUse     = errors.New("tuning in use")
+)
+
+var Instruments = []string{"fiddle", "banjo", "guitar", "mandolin", "dobro", "bass"}
+
+var tuningNotesRX = regexp.MustCompile(`^([A-Ga-g][#b]?)+$`)
+
+type Tuning struct {
+	ID         int64     `json:"id"`         // Unique integer ID for the tuning
+	CreatedAt  time.Time `json:"-"`          // Timestamp for when the tuning is added to our database
+	Instrument string    `json:"instrument"` // Instrument the tuning is for (ex: fiddle)
+	Name       string    `json:"name"`       // Tuning name (ex: Cross A, Double C)
+	Notes      string    `json:"notes"`      // Open string notes from lowest to highest (ex: AEAE, gCGCD)
+	Version    int32     `json:"version"`    // The version number starts at 1 and will be incremented each time the tuning is updated
+}
+
+func ValidateTuning(v *validator.Validator, tuning *Tuning) {
+	v.Check(tuning.Instrument != "", "instrument", "must be provided")
+	v.Check(validator.PermittedValue(tuning.Instrument, Instruments...), "instrument", "must be one of "+strings.Join(Instruments, ", "))
+
+	v.Check(tuning.Name != "", "name", "must be provided")
+	v.Check(len(tuning.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(tuning.Notes != "", "notes", "must be provided")
+	v.Check(len(tuning.Notes) <= 50, "notes", "must not be more than 50 bytes long")
+	v.Check(validator.Matches(tuning.Notes, tuningNotesRX), "notes", "must be a sequence of note names such as AEAE or gCGCD")
+}
+
+type TuningModel struct {
+	DB *sql.DB
+}
+
+// The tunings linked to a tune, selected as a JSON array alongside the tune's own
+// columns and decoded by scanTunings
+const tuneTuningsColumn = `
+			(SELECT coalesce(json_agg(json_build_object('id', tunings.id, 'instrument', tunings.instrument,
+				'name', tunings.name, 'notes', tunings.notes, 'version', tunings.version)
+				ORDER BY tunings.instrument, tunings.name), '[]')
+			FROM tunings JOIN tune_tunings ON tune_tunings.tuning_id = tunings.id
+			WHERE tune_tunings.tune_id = tunes.id)`
+
+func (tune *Tune) scanTunings(tunings []byte) error {
+	return json.Unmarshal(tunings, &tune.Tunings)
+}
+
+// writeTunings replaces the tune's links to tunings with the ones in tune.Tunings.
+func (tune *Tune) writeTunings(ctx context.Context, tx *sql.Tx) error {
+	tuningIDs := []int64{}
+	instruments := []string{}
+	for _, tuning := range tune.Tunings {
+		tuningIDs = append(tuningIDs, tuning.ID)
+		instruments = append(instruments, tuning.Instrument)
+	}
+
+	_, err := tx.ExecContext(ctx, `DELETE FROM tune_tunings WHERE tune_id = $1`, tune.ID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO tune_tunings (tune_id, tuning_id, instrument)
+		SELECT $1, unnest($2::bigint[]), unnest($3::text[])`
+
+	_, err = tx.ExecContext(ctx, query, tune.ID, pq.Array(tuningIDs), pq.Array(instruments))
+	return err
+}
+
+func (m TuningModel) Insert(tuning *Tuning) error {
+	query := `
+		INSERT INTO tunings (instrument, name, notes)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, version`
+
+	args := []any{tuning.Instrument, tuning.Name, tuning.Notes}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&tuning.ID, &tuning.CreatedAt, &tuning.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "tunings_instrument_name_key"`:
+			return ErrDuplicateTuning
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m TuningModel) Get(id int64) (*Tuning, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, instrument, name, notes, version
+		FROM tunings
+		WHERE id = $1`
+
+	var tuning Tuning
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&tuning.ID,
+		&tuning.CreatedAt,
+		&tuning.Instrument,
+		&tuning.Name,
+		&tuning.Notes,
+		&tuning.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &tuning, nil
+}
+
+func (m TuningModel) getList(query string, args ...any) ([]Tuning, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tunings := []Tuning{}
+
+	for rows.Next() {
+		var tuning Tuning
+
+		err := rows.Scan(&tuning.ID, &tuning.CreatedAt, &tuning.Instrument, &tuning.Name, &tuning.Notes, &tuning.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		tunings = append(tunings, tuning)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tunings, nil
+}
+
+// GetByIDs returns the tunings with the given IDs. IDs that do not exist are skipped,
+// so callers compare the lengths to detect them.
+func (m TuningModel) GetByIDs(ids []int64) ([]Tuning, error) {
+	query := `
+		SELECT id, created_at, instrument, name, notes, version
+		FROM tunings
+		WHERE id = ANY($1)
+		ORDER BY instrument, name`
+
+	return m.getList(query, pq.Array(ids))
+}
+
+// Find returns the tunings whose name or notes are tuning, ignoring case, limited to
+// the given instrument unless it is empty.
+func (m TuningModel) Find(instrument, tuning string) ([]Tuning, error) {
+	query := `
+		SELECT id, created_at, instrument, name, notes, version
+		FROM tunings
+		WHERE (name = $1 OR notes = $1)
+		AND (instrument = $2 OR $2 = '')
+		ORDER BY instrument, name`
+
+	return m.getList(query, tuning, instrument)
+}
+
+func (m TuningModel) GetAll(instrument, name string, filters Filters) ([]*Tuning, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, instrument, name, notes, version
+		FROM tunings
+		WHERE (instrument = $1 OR $1 = '')
+		AND (name = $2 OR notes = $2 OR $2 = '')
+		ORDER BY %s %s, id ASC
+		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, instrument, name, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	tunings := []*Tuning{}
+
+	for rows.Next() {
+		var tuning Tuning
+
+		err := rows.Scan(
+			&totalRecords,
+			&tuning.ID,
+			&tuning.CreatedAt,
+			&tuning.Instrument,
+			&tuning.Name,
+			&tuning.Notes,
+			&tuning.Version,
+		)
+
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		tunings = append(tunings, &tuning)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return tunings, metadata, nil
+}
+
+func (m TuningModel) Update(tuning *Tuning) error {
+	query := `
+		UPDATE tunings
+		SET instrument = $1, name = $2, notes = $3, version = version + 1
+		WHERE id = $4 AND version = $5
+		RETURNING version`
+
+	args := []any{tuning.Instrument, tuning.Name, tuning.Notes, tuning.ID, tuning.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&tuning.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "tunings_instrument_name_key"`:
+			return ErrDuplicateTuning
+		case err.Error() == `pq: update or delete on table "tunings" violates foreign key constraint "tune_tunings_tuning_id_instrument_fkey" on table "tune_tunings"`:
+			return ErrTuningInUse
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m TuningModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM tunings
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: update or delete on table "tunings" violates foreign key constraint "tune_tunings_tuning_id_instrument_fkey" on table "tune_tunings"`:
+			return ErrTuningInUse
+		default:
+			return err
+		}
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// CountTunes returns the number of tunes linked to the tuning.
+func (m TuningModel) CountTunes(id int64) (int, error) {
+	query := `
+		SELECT count(*)
+		FROM tune_tunings
+		WHERE tuning_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,130 @@
+package midi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/bits"
+	"slices"
+)
+
+// Division is the number of ticks in a quarter note.
+const Division = 480
+
+// Note is a note played on the sequence's single channel.
+type Note struct {
+	Start    int // Ticks from the start of the sequence
+	Length   int // Length in ticks
+	Pitch    int // MIDI note number, 60 being middle C
+	Velocity int // From 1 to 127
+}
+
+// Sequence is a single-track melody, written as a format 0 Standard MIDI File.
+type Sequence struct {
+	Name                   string // Track name
+	Beats                  int    // Upper number of the time signature
+	Unit                   int    // Lower number of the time signature, a power of two
+	ClocksPerClick         int    // MIDI clocks (24 to a quarter note) per metronome click
+	Sharps                 int    // Sharps in the key signature, negative for flats
+	Minor                  bool   // Whether the key signature is for a minor key
+	MicrosecondsPerQuarter int    // Tempo
+	Notes                  []Note
+}
+
+type event struct {
+	tick int
+	off  bool // Note offs sort before note ons at the same tick so repeated notes are re-struck
+	data []byte
+}
+
+// Encode returns the sequence as a Standard MIDI File.
+func (s *Sequence) Encode() []byte {
+	events := []event{
+		{data: meta(0x03, []byte(s.Name))},
+		{data: meta(0x58, []byte{byte(s.Beats), byte(bits.TrailingZeros(uint(s.Unit))), byte(s.ClocksPerClick), 8})},
+		{data: meta(0x59, []byte{byte(int8(max(-7, min(s.Sharps, 7)))), boolByte(s.Minor)})},
+		{data: meta(0x51, tempoBytes(s.MicrosecondsPerQuarter))},
+	}
+
+	end := 0
+
+	for _, note := range s.Notes {
+		if note.Pitch < 0 || note.Pitch > 127 || note.Length < 1 {
+			continue
+		}
+
+		velocity := byte(max(1, min(note.Velocity, 127)))
+
+		events = append(events,
+			event{tick: note.Start, data: []byte{0x90, byte(note.Pitch), velocity}},
+			event{tick: note.Start + note.Length, off: true, data: []byte{0x80, byte(note.Pitch), 0}},
+		)
+
+		end = max(end, note.Start+note.Length)
+	}
+
+	// The header events stay first, as a stable sort leaves events at tick 0 in order
+	slices.SortStableFunc(events, func(a, b event) int {
+		switch {
+		case a.tick != b.tick:
+			return a.tick - b.tick
+		case a.off != b.off && a.off:
+			return -1
+		case a.off != b.off:
+			return 1
+		}
+		return 0
+	})
+
+	events = append(events, event{tick: end, data: meta(0x2F, nil)})
+
+	var track bytes.Buffer
+	last := 0
+
+	for _, e := range events {
+		track.Write(varint(e.tick - last))
+		track.Write(e.data)
+		last = e.tick
+	}
+
+	var file bytes.Buffer
+
+	file.WriteString("MThd")
+	binary.Write(&file, binary.BigEndian, []uint32{6})
+	binary.Write(&file, binary.BigEndian, []uint16{0, 1, Division})
+
+	file.WriteString("MTrk")
+	binary.Write(&file, binary.BigEndian, uint32(track.Len()))
+	file.Write(track.Bytes())
+
+	return file.Bytes()
+}
+
+func meta(kind byte, data []byte) []byte {
+	return slices.Concat([]byte{0xFF, kind}, varint(len(data)), data)
+}
+
+// tempoBytes returns the tempo as the three bytes of a set tempo event, clamped to
+// what they can hold.
+func tempoBytes(microseconds int) []byte {
+	microseconds = max(1, min(microseconds, 0xFFFFFF))
+	return []byte{byte(microseconds >> 16), byte(microseconds >> 8), byte(microseconds)}
+}
+
+// varint encodes n as a MIDI variable-length quantity, seven bits to a byte with the
+// high bit set on all but the last.
+func varint(n int) []byte {
+	b := []byte{byte(n & 0x7F)}
+
+	for n >>= 7; n > 0; n >>= 7 {
+		b = append([]byte{byte(n&0x7F) | 0x80}, b...)
+	}
+
+	return b
+}
+
+func boolByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,81 @@
+package midi
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name string
+		seq  Sequence
+	}{
+		{
+			// 120 BPM, with the repeated D needing its note off before the next note on
+			name: "reel_4_4_d_major",
+			seq: Sequence{
+				Name: "Reel", Beats: 4, Unit: 4, ClocksPerClick: 24, Sharps: 2,
+				MicrosecondsPerQuarter: 500_000,
+				Notes: []Note{
+					{Start: 0, Length: 240, Pitch: 62, Velocity: 80},
+					{Start: 240, Length: 240, Pitch: 62, Velocity: 80},
+					{Start: 480, Length: 960, Pitch: 66, Velocity: 80},
+				},
+			},
+		},
+		{
+			// Dotted quarter beats at 120 BPM, with a chord of two notes
+			name: "jig_6_8_e_minor",
+			seq: Sequence{
+				Name: "Jig", Beats: 6, Unit: 8, ClocksPerClick: 36, Sharps: 1, Minor: true,
+				MicrosecondsPerQuarter: 333_333,
+				Notes: []Note{
+					{Start: 0, Length: 240, Pitch: 64, Velocity: 80},
+					{Start: 0, Length: 240, Pitch: 71, Velocity: 80},
+					{Start: 240, Length: 480, Pitch: 67, Velocity: 80},
+				},
+			},
+		},
+		{
+			// A rest long enough to need a three byte delta time before the last note
+			name: "waltz_3_4_bb_major",
+			seq: Sequence{
+				Name: "Waltz", Beats: 3, Unit: 4, ClocksPerClick: 24, Sharps: -2,
+				MicrosecondsPerQuarter: 600_000,
+				Notes: []Note{
+					{Start: 0, Length: 1440, Pitch: 70, Velocity: 80},
+					{Start: 20_000, Length: 480, Pitch: 65, Velocity: 80},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.seq.Encode()
+
+			golden := filepath.Join("testdata", tt.name+".mid")
+
+			if *update {
+				err := os.WriteFile(golden, got, 0o644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(got, want) {
+				t.Errorf("encoding does not match %s\ngot:  % x\nwant: % x", golden, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"path"
+)
+
+var ErrNotFound = errors.New("storage: file not found")
+
+// Storage holds the files uploaded to the API, such as recordings, by key. Keys are
+// slash-separated relative paths (ex: recordings/12/9f86d081884c7d65) and are chosen
+// by the caller, normally with NewKey.
+type Storage interface {
+	// Put stores the contents of r under key, replacing any file already there. A
+	// file is only visible under the key once it has been completely written.
+	Put(key string, r io.Reader) error
+
+	// Open returns the file stored under key, or ErrNotFound if there is none.
+	Open(key string) (io.ReadSeekCloser, error)
+
+	// Delete removes the file stored under key. Deleting a missing file is not an
+	// error.
+	Delete(key string) error
+}
+
+// NewKey returns a new random key under the given directory.
+func NewKey(dir string) (string, error) {
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(dir, hex.EncodeToString(b)), nil
+}
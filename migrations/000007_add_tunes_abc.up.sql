@@ -0,0 +1 @@
+ALTER TABLE tunes ADD COLUMN IF NOT EXISTS abc text;
\ No newline at end of file
@@ -0,0 +1 @@
+-- Normalizing key spellings is not reversible, the canonical values remain valid.
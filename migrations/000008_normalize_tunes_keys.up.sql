@@ -0,0 +1,120 @@
+UPDATE tunes
+SET keys = normalized.keys
+FROM (
+    SELECT tunes.id, array_agg(
+        CASE
+            WHEN parts IS NULL OR mode IS NULL THEN k.value
+            ELSE upper(parts[1]) || parts[2] || ' ' || mode
+        END
+        ORDER BY k.ordinal
+    ) AS keys
+    FROM tunes
+    CROSS JOIN LATERAL unnest(tunes.keys) WITH ORDINALITY AS k(value, ordinal)
+    CROSS JOIN LATERAL (SELECT regexp_match(trim(k.value), '^([A-Ga-g])([#b]?)\s*([A-Za-z]*)$') AS parts) AS matched
+    CROSS JOIN LATERAL (
+        SELECT CASE
+            WHEN lower(parts[3]) = '' THEN 'major'
+            WHEN lower(parts[3]) = 'm' THEN 'minor'
+            WHEN length(parts[3]) < 3 THEN NULL
+            WHEN 'major' LIKE lower(parts[3]) || '%' OR 'ionian' LIKE lower(parts[3]) || '%' THEN 'major'
+            WHEN 'minor' LIKE lower(parts[3]) || '%' OR 'aeolian' LIKE lower(parts[3]) || '%' THEN 'minor'
+            WHEN 'dorian' LIKE lower(parts[3]) || '%' THEN 'dorian'
+            WHEN 'phrygian' LIKE lower(parts[3]) || '%' THEN 'phrygian'
+            WHEN 'lydian' LIKE lower(parts[3]) || '%' THEN 'lydian'
+            WHEN 'mixolydian' LIKE lower(parts[3]) || '%' THEN 'mixolydian'
+            WHEN 'locrian' LIKE lower(parts[3]) || '%' THEN 'locrian'
+        END AS mode
+    ) AS normalized_mode
+    GROUP BY tunes.id
+) AS normalized
+WHERE tunes.id = normalized.id
+AND tunes.keys IS DISTINCT FROM normalized.keys;
+
+-- Keys are then respelled canonically, with the fewest accidentals in their signature,
+-- so that enharmonic keys such as Gb major and F# major compare equal. The spellings
+-- below are every one that Key.Canonical respells.
+CREATE TEMPORARY TABLE canonical_keys (
+    spelling text PRIMARY KEY,
+    canonical text NOT NULL
+);
+
+INSERT INTO canonical_keys (spelling, canonical) VALUES
+    ('C# major', 'Db major'),
+    ('Cb major', 'B major'),
+    ('D# major', 'Eb major'),
+    ('E# major', 'F major'),
+    ('Fb major', 'E major'),
+    ('G# major', 'Ab major'),
+    ('Gb major', 'F# major'),
+    ('A# major', 'Bb major'),
+    ('B# major', 'C major'),
+    ('Cb minor', 'B minor'),
+    ('Db minor', 'C# minor'),
+    ('E# minor', 'F minor'),
+    ('Eb minor', 'D# minor'),
+    ('Fb minor', 'E minor'),
+    ('Gb minor', 'F# minor'),
+    ('A# minor', 'Bb minor'),
+    ('Ab minor', 'G# minor'),
+    ('B# minor', 'C minor'),
+    ('Cb dorian', 'B dorian'),
+    ('D# dorian', 'Eb dorian'),
+    ('Db dorian', 'C# dorian'),
+    ('E# dorian', 'F dorian'),
+    ('Fb dorian', 'E dorian'),
+    ('Gb dorian', 'F# dorian'),
+    ('A# dorian', 'Bb dorian'),
+    ('Ab dorian', 'G# dorian'),
+    ('B# dorian', 'C dorian'),
+    ('Cb phrygian', 'B phrygian'),
+    ('Db phrygian', 'C# phrygian'),
+    ('E# phrygian', 'F phrygian'),
+    ('Eb phrygian', 'D# phrygian'),
+    ('Fb phrygian', 'E phrygian'),
+    ('Gb phrygian', 'F# phrygian'),
+    ('Ab phrygian', 'G# phrygian'),
+    ('B# phrygian', 'C phrygian'),
+    ('Bb phrygian', 'A# phrygian'),
+    ('C# lydian', 'Db lydian'),
+    ('Cb lydian', 'B lydian'),
+    ('D# lydian', 'Eb lydian'),
+    ('E# lydian', 'F lydian'),
+    ('F# lydian', 'Gb lydian'),
+    ('Fb lydian', 'E lydian'),
+    ('G# lydian', 'Ab lydian'),
+    ('A# lydian', 'Bb lydian'),
+    ('B# lydian', 'C lydian'),
+    ('Cb mixolydian', 'B mixolydian'),
+    ('D# mixolydian', 'Eb mixolydian'),
+    ('Db mixolydian', 'C# mixolydian'),
+    ('E# mixolydian', 'F mixolydian'),
+    ('Fb mixolydian', 'E mixolydian'),
+    ('G# mixolydian', 'Ab mixolydian'),
+    ('Gb mixolydian', 'F# mixolydian'),
+    ('A# mixolydian', 'Bb mixolydian'),
+    ('B# mixolydian', 'C mixolydian'),
+    ('Cb locrian', 'B locrian'),
+    ('Db locrian', 'C# locrian'),
+    ('Eb locrian', 'D# locrian'),
+    ('Fb locrian', 'E locrian'),
+    ('Gb locrian', 'F# locrian'),
+    ('Ab locrian', 'G# locrian'),
+    ('B# locrian', 'C locrian'),
+    ('Bb locrian', 'A# locrian');
+
+-- A tune listing both spellings of a key keeps it once, where it first appeared
+UPDATE tunes
+SET keys = ARRAY(
+    SELECT canonical.value
+    FROM (
+        SELECT DISTINCT ON (coalesce(canonical_keys.canonical, k.value))
+            coalesce(canonical_keys.canonical, k.value) AS value, k.ordinal
+        FROM unnest(tunes.keys) WITH ORDINALITY AS k(value, ordinal)
+        LEFT JOIN canonical_keys ON canonical_keys.spelling = k.value
+        ORDER BY coalesce(canonical_keys.canonical, k.value), k.ordinal
+    ) AS canonical
+    ORDER BY canonical.ordinal
+)
+WHERE keys && ARRAY(SELECT spelling FROM canonical_keys);
+
+DROP TABLE canonical_keys;
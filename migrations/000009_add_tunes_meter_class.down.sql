@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS tunes_meter_class_idx;
+ALTER TABLE tunes DROP COLUMN IF EXISTS meter_class;
+ALTER TABLE tunes DROP CONSTRAINT IF EXISTS time_signature_format_check;
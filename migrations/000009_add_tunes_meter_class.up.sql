@@ -0,0 +1,15 @@
+ALTER TABLE tunes ADD CONSTRAINT time_signature_format_check CHECK (time_signature ~ '^[1-9][0-9]?/(1|2|4|8|16|32|64)$') NOT VALID;
+
+ALTER TABLE tunes ADD COLUMN IF NOT EXISTS meter_class text GENERATED ALWAYS AS (
+    CASE split_part(time_signature, '/', 1)
+        WHEN '2' THEN 'duple'
+        WHEN '3' THEN 'triple'
+        WHEN '4' THEN 'quadruple'
+        WHEN '6' THEN 'compound duple'
+        WHEN '9' THEN 'compound triple'
+        WHEN '12' THEN 'compound quadruple'
+        ELSE 'irregular'
+    END
+) STORED;
+
+CREATE INDEX IF NOT EXISTS tunes_meter_class_idx ON tunes (meter_class);
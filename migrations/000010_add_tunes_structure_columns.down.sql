@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS tunes_part_count_idx;
+ALTER TABLE tunes DROP COLUMN IF EXISTS crooked;
+ALTER TABLE tunes DROP COLUMN IF EXISTS part_count;
@@ -0,0 +1,17 @@
+ALTER TABLE tunes ADD COLUMN IF NOT EXISTS part_count integer;
+ALTER TABLE tunes ADD COLUMN IF NOT EXISTS crooked boolean NOT NULL DEFAULT false;
+
+UPDATE tunes
+SET part_count = (
+        SELECT count(DISTINCT part[1])
+        FROM regexp_matches(structure, '([A-Z]''*)', 'g') AS part
+    ),
+    crooked = EXISTS (
+        SELECT 1
+        FROM regexp_matches(structure, '([A-Z]''*)\((\d+)\)', 'g') AS part
+        GROUP BY part[1]
+        HAVING bool_or(part[2]::integer % 4 <> 0) OR count(DISTINCT part[2]::integer) > 1
+    )
+WHERE structure ~ '^([A-Z]''*(\(\d{1,3}\))?|[ -])+$';
+
+CREATE INDEX IF NOT EXISTS tunes_part_count_idx ON tunes (part_count);
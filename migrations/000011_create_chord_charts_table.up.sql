@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS chord_charts (
+    tune_id bigint PRIMARY KEY REFERENCES tunes ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    key text NOT NULL,
+    parts jsonb NOT NULL,
+    version integer NOT NULL DEFAULT 1
+);
@@ -0,0 +1,7 @@
+ALTER TABLE tunes ADD COLUMN IF NOT EXISTS has_lyrics boolean NOT NULL DEFAULT false;
+
+UPDATE tunes SET has_lyrics = EXISTS (SELECT 1 FROM lyrics WHERE lyrics.tune_id = tunes.id);
+
+ALTER TABLE tunes ALTER COLUMN has_lyrics DROP DEFAULT;
+
+DROP TABLE IF EXISTS lyrics;
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS lyrics (
+    tune_id bigint PRIMARY KEY REFERENCES tunes ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    sections jsonb NOT NULL,
+    text text NOT NULL,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS lyrics_text_idx ON lyrics USING GIN (to_tsvector('simple', text));
+
+-- Whether a tune has lyrics is read from the lyrics table instead of being stored. No
+-- tune has lyrics stored yet, so the tunes flagged as having them are reported for
+-- their words to be added.
+DO $$
+DECLARE
+    flagged text;
+BEGIN
+    SELECT string_agg(title, ', ' ORDER BY title) INTO flagged FROM tunes WHERE has_lyrics;
+
+    IF flagged IS NOT NULL THEN
+        RAISE NOTICE 'tunes flagged as having lyrics with none stored: %', flagged;
+    END IF;
+END $$;
+
+ALTER TABLE tunes DROP COLUMN IF EXISTS has_lyrics;
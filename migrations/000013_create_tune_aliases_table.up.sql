@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS tune_aliases (
+    id bigserial PRIMARY KEY,
+    tune_id bigint NOT NULL REFERENCES tunes ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    title citext NOT NULL,
+    UNIQUE (tune_id, title)
+);
+
+CREATE INDEX IF NOT EXISTS tune_aliases_title_idx ON tune_aliases USING GIN (to_tsvector('simple', title));
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS tune_sources;
+DROP TABLE IF EXISTS tune_composers;
+DROP TABLE IF EXISTS sources;
+DROP TABLE IF EXISTS composers;
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS composers (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name citext UNIQUE NOT NULL,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS sources (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    kind text NOT NULL CHECK (kind IN ('player', 'recording', 'collection', 'region')),
+    description text NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1,
+    UNIQUE (name, kind)
+);
+
+-- Composers cannot be deleted while they are credited on a tune, whereas deleting a
+-- source only removes it from the tunes that cite it
+CREATE TABLE IF NOT EXISTS tune_composers (
+    tune_id bigint NOT NULL REFERENCES tunes ON DELETE CASCADE,
+    composer_id bigint NOT NULL REFERENCES composers ON DELETE RESTRICT,
+    PRIMARY KEY (tune_id, composer_id)
+);
+
+CREATE TABLE IF NOT EXISTS tune_sources (
+    tune_id bigint NOT NULL REFERENCES tunes ON DELETE CASCADE,
+    source_id bigint NOT NULL REFERENCES sources ON DELETE CASCADE,
+    PRIMARY KEY (tune_id, source_id)
+);
+
+CREATE INDEX IF NOT EXISTS tune_composers_composer_id_idx ON tune_composers (composer_id);
+CREATE INDEX IF NOT EXISTS tune_sources_source_id_idx ON tune_sources (source_id);
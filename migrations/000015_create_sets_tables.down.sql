@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS set_tunes;
+DROP TABLE IF EXISTS sets;
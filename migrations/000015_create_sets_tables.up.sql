@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS sets (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS set_tunes (
+    set_id bigint NOT NULL REFERENCES sets ON DELETE CASCADE,
+    position integer NOT NULL,
+    tune_id bigint NOT NULL REFERENCES tunes ON DELETE CASCADE,
+    key text,
+    repeats integer NOT NULL DEFAULT 1 CHECK (repeats BETWEEN 1 AND 10),
+    PRIMARY KEY (set_id, position)
+);
+
+CREATE INDEX IF NOT EXISTS set_tunes_tune_id_idx ON set_tunes (tune_id);
+CREATE INDEX IF NOT EXISTS sets_name_idx ON sets USING GIN (to_tsvector('simple', name));
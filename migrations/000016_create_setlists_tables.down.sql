@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS setlist_entries;
+DROP TABLE IF EXISTS setlists;
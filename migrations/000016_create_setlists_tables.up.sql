@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS setlists (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    notes text NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1
+);
+
+-- An entry's key is NULL unless one was chosen for it. Entries without one are played
+-- in the tune's first key, and follow any change to the tune's keys.
+CREATE TABLE IF NOT EXISTS setlist_entries (
+    setlist_id bigint NOT NULL REFERENCES setlists ON DELETE CASCADE,
+    position integer NOT NULL,
+    tune_id bigint NOT NULL REFERENCES tunes ON DELETE CASCADE,
+    key text,
+    duration_seconds integer NOT NULL DEFAULT 0 CHECK (duration_seconds >= 0),
+    notes text NOT NULL DEFAULT '',
+    PRIMARY KEY (setlist_id, position)
+);
+
+CREATE INDEX IF NOT EXISTS setlist_entries_tune_id_idx ON setlist_entries (tune_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS jam_plays;
+DROP TABLE IF EXISTS jam_attendees;
+DROP TABLE IF EXISTS jams;
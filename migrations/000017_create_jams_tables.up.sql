@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS jams (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    date date NOT NULL,
+    location text NOT NULL,
+    host_id bigint REFERENCES users ON DELETE SET NULL,
+    notes text NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS jam_attendees (
+    jam_id bigint NOT NULL REFERENCES jams ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    PRIMARY KEY (jam_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS jam_plays (
+    id bigserial PRIMARY KEY,
+    jam_id bigint NOT NULL REFERENCES jams ON DELETE CASCADE,
+    tune_id bigint NOT NULL REFERENCES tunes ON DELETE CASCADE,
+    played_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    key text,
+    notes text NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS jams_date_idx ON jams (date);
+CREATE INDEX IF NOT EXISTS jam_plays_jam_id_idx ON jam_plays (jam_id, played_at);
+CREATE INDEX IF NOT EXISTS jam_plays_tune_id_idx ON jam_plays (tune_id);
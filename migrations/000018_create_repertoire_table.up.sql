@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS repertoire (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    tune_id bigint NOT NULL REFERENCES tunes ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    proficiency text NOT NULL CHECK (proficiency IN ('learning', 'can_follow', 'can_lead')),
+    preferred_key text,
+    instrument text NOT NULL DEFAULT '',
+    last_practiced_at timestamp(0) with time zone,
+    version integer NOT NULL DEFAULT 1,
+    PRIMARY KEY (user_id, tune_id)
+);
+
+CREATE INDEX IF NOT EXISTS repertoire_tune_id_idx ON repertoire (tune_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS practice_schedule;
+DROP TABLE IF EXISTS practice_sessions;
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS practice_sessions (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    tune_id bigint NOT NULL REFERENCES tunes ON DELETE CASCADE,
+    practiced_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    duration_seconds integer NOT NULL CHECK (duration_seconds > 0),
+    quality integer NOT NULL CHECK (quality BETWEEN 0 AND 5),
+    notes text NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS practice_sessions_user_id_practiced_at_idx ON practice_sessions (user_id, practiced_at);
+
+CREATE TABLE IF NOT EXISTS practice_schedule (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    tune_id bigint NOT NULL REFERENCES tunes ON DELETE CASCADE,
+    repetitions integer NOT NULL DEFAULT 0,
+    ease_factor double precision NOT NULL DEFAULT 2.5,
+    interval_days integer NOT NULL DEFAULT 0,
+    last_reviewed_at timestamp(0) with time zone NOT NULL,
+    due_at timestamp(0) with time zone NOT NULL,
+    PRIMARY KEY (user_id, tune_id)
+);
+
+CREATE INDEX IF NOT EXISTS practice_schedule_user_id_due_at_idx ON practice_schedule (user_id, due_at);
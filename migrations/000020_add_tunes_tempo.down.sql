@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS tunes_tempo_idx;
+
+ALTER TABLE tunes DROP CONSTRAINT IF EXISTS tempo_range_check;
+
+ALTER TABLE tunes DROP COLUMN IF EXISTS tempo_max;
+ALTER TABLE tunes DROP COLUMN IF EXISTS tempo_min;
@@ -0,0 +1,6 @@
+ALTER TABLE tunes ADD COLUMN IF NOT EXISTS tempo_min integer;
+ALTER TABLE tunes ADD COLUMN IF NOT EXISTS tempo_max integer;
+
+ALTER TABLE tunes ADD CONSTRAINT tempo_range_check CHECK ((tempo_min IS NULL) = (tempo_max IS NULL) AND tempo_min BETWEEN 20 AND tempo_max AND tempo_max <= 400);
+
+CREATE INDEX IF NOT EXISTS tunes_tempo_idx ON tunes (tempo_min, tempo_max);
@@ -0,0 +1,9 @@
+-- Tunes keep the canonical style IDs they were mapped to, the original free text is
+-- not restored
+DROP VIEW IF EXISTS unmatched_tune_styles;
+
+DROP INDEX IF EXISTS tunes_tune_type_idx;
+ALTER TABLE tunes DROP COLUMN IF EXISTS tune_type;
+
+DROP TABLE IF EXISTS style_synonyms;
+DROP TABLE IF EXISTS styles;
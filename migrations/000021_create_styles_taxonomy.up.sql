@@ -0,0 +1,108 @@
+-- Styles are identified by a lowercase canonical ID (ex: old_time), which is what
+-- tunes.styles holds. Synonyms map the other spellings in use onto those IDs.
+CREATE TABLE IF NOT EXISTS styles (
+    id text PRIMARY KEY CHECK (id ~ '^[a-z0-9]+(_[a-z0-9]+)*$'),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name citext UNIQUE NOT NULL,
+    parent_id text REFERENCES styles ON DELETE RESTRICT,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS style_synonyms (
+    synonym citext PRIMARY KEY,
+    style_id text NOT NULL REFERENCES styles ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS styles_parent_id_idx ON styles (parent_id);
+CREATE INDEX IF NOT EXISTS style_synonyms_style_id_idx ON style_synonyms (style_id);
+
+INSERT INTO styles (id, name, parent_id) VALUES
+    ('bluegrass', 'Bluegrass', NULL),
+    ('newgrass', 'Newgrass', 'bluegrass'),
+    ('old_time', 'Old-time', NULL),
+    ('texas', 'Texas', NULL),
+    ('celtic', 'Celtic', NULL),
+    ('irish', 'Irish', 'celtic'),
+    ('scottish', 'Scottish', 'celtic'),
+    ('cape_breton', 'Cape Breton', 'scottish'),
+    ('shetland', 'Shetland', 'scottish'),
+    ('english', 'English', NULL),
+    ('quebecois', 'Québécois', NULL),
+    ('klezmer', 'Klezmer', NULL),
+    ('western_swing', 'Western swing', NULL)
+ON CONFLICT DO NOTHING;
+
+INSERT INTO style_synonyms (synonym, style_id) VALUES
+    ('BG', 'bluegrass'),
+    ('Old time', 'old_time'),
+    ('Oldtime', 'old_time'),
+    ('Old timey', 'old_time'),
+    ('OT', 'old_time'),
+    ('Texas contest', 'texas'),
+    ('Irish trad', 'irish'),
+    ('Trad Irish', 'irish'),
+    ('Scotch', 'scottish'),
+    ('Quebecois', 'quebecois'),
+    ('French Canadian', 'quebecois')
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE tunes ADD COLUMN IF NOT EXISTS tune_type text CHECK (tune_type IN ('reel', 'jig', 'slip_jig', 'single_jig',
+    'hornpipe', 'polka', 'slide', 'strathspey', 'march', 'waltz', 'mazurka', 'schottische', 'barndance', 'breakdown',
+    'rag', 'two_step', 'air', 'song'));
+
+CREATE INDEX IF NOT EXISTS tunes_tune_type_idx ON tunes (tune_type);
+
+-- Map every free-text style in use onto a canonical style, through its ID, name or a
+-- synonym, and onto a tune type where the style was really the kind of tune
+CREATE TEMPORARY TABLE style_mapping AS
+SELECT raw,
+    coalesce(
+        (SELECT styles.id FROM styles WHERE styles.id = normalized OR styles.name = raw::citext LIMIT 1),
+        (SELECT style_synonyms.style_id FROM style_synonyms WHERE style_synonyms.synonym = raw::citext)
+    ) AS style_id,
+    CASE WHEN normalized IN ('reel', 'jig', 'slip_jig', 'single_jig', 'hornpipe', 'polka', 'slide', 'strathspey',
+        'march', 'waltz', 'mazurka', 'schottische', 'barndance', 'breakdown', 'rag', 'two_step', 'air', 'song')
+        THEN normalized END AS tune_type
+FROM (
+    SELECT DISTINCT raw, trim(BOTH '_' FROM regexp_replace(lower(raw), '[^a-z0-9]+', '_', 'g')) AS normalized
+    FROM tunes, unnest(tunes.styles) AS raw
+) AS existing;
+
+UPDATE tunes SET tune_type = (
+    SELECT style_mapping.tune_type
+    FROM unnest(tunes.styles) WITH ORDINALITY AS s(raw, n)
+    JOIN style_mapping USING (raw)
+    WHERE style_mapping.tune_type IS NOT NULL
+    ORDER BY n
+    LIMIT 1)
+WHERE tune_type IS NULL;
+
+-- Matched styles are replaced by their IDs and tune types are dropped from the styles,
+-- unless that would leave none. Unmatched styles are kept as they are for now.
+UPDATE tunes SET styles = coalesce(nullif(ARRAY(
+    SELECT coalesce(style_mapping.style_id, style_mapping.raw)
+    FROM unnest(tunes.styles) WITH ORDINALITY AS s(raw, n)
+    JOIN style_mapping USING (raw)
+    WHERE style_mapping.style_id IS NOT NULL OR style_mapping.tune_type IS NULL
+    GROUP BY 1
+    ORDER BY min(n)), '{}'), tunes.styles);
+
+DROP TABLE style_mapping;
+
+-- The styles left on tunes that are not in the taxonomy, until they are added to it as
+-- a style or synonym
+CREATE OR REPLACE VIEW unmatched_tune_styles AS
+SELECT tunes.id AS tune_id, tunes.title, style
+FROM tunes, unnest(tunes.styles) AS style
+WHERE NOT EXISTS (SELECT 1 FROM styles WHERE styles.id = style);
+
+DO $$
+DECLARE
+    unmatched text;
+BEGIN
+    SELECT string_agg(DISTINCT style, ', ') INTO unmatched FROM unmatched_tune_styles;
+
+    IF unmatched IS NOT NULL THEN
+        RAISE NOTICE 'styles not matched to the taxonomy: %', unmatched;
+    END IF;
+END $$;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS tune_tunings;
+DROP TABLE IF EXISTS tunings;
@@ -0,0 +1,50 @@
+CREATE TABLE IF NOT EXISTS tunings (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    instrument text NOT NULL CHECK (instrument IN ('fiddle', 'banjo', 'guitar', 'mandolin', 'dobro', 'bass')),
+    name citext NOT NULL,
+    notes citext NOT NULL,
+    version integer NOT NULL DEFAULT 1,
+    UNIQUE (instrument, name),
+    UNIQUE (id, instrument)
+);
+
+-- The instrument is repeated on the link so that the foreign key guarantees a tune is
+-- only ever linked to a tuning for the instrument it is recorded against, which also
+-- keeps a tuning's instrument from changing while tunes use it
+CREATE TABLE IF NOT EXISTS tune_tunings (
+    tune_id bigint NOT NULL REFERENCES tunes ON DELETE CASCADE,
+    tuning_id bigint NOT NULL,
+    instrument text NOT NULL,
+    PRIMARY KEY (tune_id, tuning_id),
+    FOREIGN KEY (tuning_id, instrument) REFERENCES tunings (id, instrument) ON DELETE RESTRICT ON UPDATE RESTRICT
+);
+
+CREATE INDEX IF NOT EXISTS tune_tunings_tuning_id_idx ON tune_tunings (tuning_id);
+
+-- Strings are listed from lowest to highest, except for the banjo's short fifth string
+-- which comes first in lowercase
+INSERT INTO tunings (instrument, name, notes) VALUES
+    ('fiddle', 'Standard', 'GDAE'),
+    ('fiddle', 'Cross A', 'AEAE'),
+    ('fiddle', 'Calico', 'AEAC#'),
+    ('fiddle', 'Cross G', 'GDGD'),
+    ('fiddle', 'Dead Man''s', 'DDAD'),
+    ('fiddle', 'Open D', 'ADAD'),
+    ('banjo', 'Open G', 'gDGBD'),
+    ('banjo', 'Double C', 'gCGCD'),
+    ('banjo', 'Standard C', 'gCGBD'),
+    ('banjo', 'Double D', 'aDADE'),
+    ('banjo', 'Sawmill', 'gDGCD'),
+    ('banjo', 'Open D', 'f#DF#AD'),
+    ('banjo', 'Open A', 'aEAC#E'),
+    ('guitar', 'Standard', 'EADGBE'),
+    ('guitar', 'Drop D', 'DADGBE'),
+    ('guitar', 'DADGAD', 'DADGAD'),
+    ('guitar', 'Open G', 'DGDGBD'),
+    ('guitar', 'Open D', 'DADF#AD'),
+    ('mandolin', 'Standard', 'GDAE'),
+    ('mandolin', 'Cross A', 'AEAE'),
+    ('dobro', 'Open G', 'GBDGBD'),
+    ('bass', 'Standard', 'EADG')
+ON CONFLICT DO NOTHING;
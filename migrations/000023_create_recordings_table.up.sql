@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS recordings (
+    id bigserial PRIMARY KEY,
+    tune_id bigint NOT NULL REFERENCES tunes ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    filename text NOT NULL,
+    mime_type text NOT NULL,
+    size_bytes bigint NOT NULL CHECK (size_bytes > 0),
+    duration_seconds numeric(8, 2) CHECK (duration_seconds > 0),
+    checksum text NOT NULL,
+    storage_key text NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS recordings_tune_id_idx ON recordings (tune_id);
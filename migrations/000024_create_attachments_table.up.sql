@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS attachments (
+    id bigserial PRIMARY KEY,
+    tune_id bigint NOT NULL REFERENCES tunes ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    kind text NOT NULL CHECK (kind IN ('sheet_music', 'tab', 'chart')),
+    instrument text CHECK (instrument IN ('fiddle', 'banjo', 'guitar', 'mandolin', 'dobro', 'bass')),
+    filename text NOT NULL,
+    mime_type text NOT NULL,
+    size_bytes bigint NOT NULL CHECK (size_bytes > 0),
+    checksum text NOT NULL,
+    storage_key text NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS attachments_tune_id_idx ON attachments (tune_id);
@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS tune_aliases_title_trgm_idx;
+DROP INDEX IF EXISTS tune_aliases_title_idx;
+CREATE INDEX IF NOT EXISTS tune_aliases_title_idx ON tune_aliases USING GIN (to_tsvector('simple', title));
+
+DROP INDEX IF EXISTS tunes_title_trgm_idx;
+DROP INDEX IF EXISTS tunes_title_idx;
+CREATE INDEX IF NOT EXISTS tunes_title_idx ON tunes USING GIN (to_tsvector('simple', title));
+
+DROP TEXT SEARCH CONFIGURATION IF EXISTS simple_unaccent;
+DROP FUNCTION IF EXISTS fold_title(text);
+
+-- The extensions are left installed, as they may have been created by the server setup
@@ -0,0 +1,21 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+-- unaccent() is only STABLE, as it looks its dictionary up by name, so it is wrapped with
+-- the dictionary given explicitly to be usable in the trigram indexes below
+CREATE OR REPLACE FUNCTION fold_title(title text) RETURNS text
+    LANGUAGE sql IMMUTABLE PARALLEL SAFE STRICT
+    AS $$ SELECT lower(public.unaccent('public.unaccent'::regdictionary, title)) $$;
+
+-- Like the simple configuration, but with accents stripped so that "Cailín" and "Cailin"
+-- or "Reel à Bouchard" and "Reel a Bouchard" match each other
+CREATE TEXT SEARCH CONFIGURATION simple_unaccent (COPY = simple);
+ALTER TEXT SEARCH CONFIGURATION simple_unaccent ALTER MAPPING FOR hword, hword_part, word WITH unaccent, simple;
+
+DROP INDEX IF EXISTS tunes_title_idx;
+CREATE INDEX IF NOT EXISTS tunes_title_idx ON tunes USING GIN (to_tsvector('simple_unaccent', title));
+CREATE INDEX IF NOT EXISTS tunes_title_trgm_idx ON tunes USING GIN (fold_title(title) gin_trgm_ops);
+
+DROP INDEX IF EXISTS tune_aliases_title_idx;
+CREATE INDEX IF NOT EXISTS tune_aliases_title_idx ON tune_aliases USING GIN (to_tsvector('simple_unaccent', title));
+CREATE INDEX IF NOT EXISTS tune_aliases_title_trgm_idx ON tune_aliases USING GIN (fold_title(title) gin_trgm_ops);
@@ -60,6 +60,8 @@ apt --yes install postgresql
 # Set up the jambuster DB and create a user account with the password entered earlier.
 sudo -i -u postgres psql -c "CREATE DATABASE jambuster"
 sudo -i -u postgres psql -d jambuster -c "CREATE EXTENSION IF NOT EXISTS citext"
+sudo -i -u postgres psql -d jambuster -c "CREATE EXTENSION IF NOT EXISTS pg_trgm"
+sudo -i -u postgres psql -d jambuster -c "CREATE EXTENSION IF NOT EXISTS unaccent"
 sudo -i -u postgres psql -d jambuster -c "CREATE ROLE jambuster WITH LOGIN PASSWORD '${DB_PASSWORD}'"
 
 # Add a DSN for connecting to the jambuster database.